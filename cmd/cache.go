@@ -0,0 +1,187 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"com.github/RawSanj/setup/util"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var pruneOlderThan string
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the local cache of downloaded archives",
+	Long: `manage the local cache of downloaded archives.
+Downloaded archives are kept in the cache, so reinstalling a version or installing
+it for another user account doesn't download it again.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list cached archives, most recently used first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		cacheDir, err := util.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+
+		entries, err := util.ListCache(cacheDir)
+		if err != nil {
+			return errors.New("Error Reading Download Cache. Error: " + err.Error())
+		}
+
+		fmt.Println("Cache directory:", cacheDir)
+		printCacheEntries(entries)
+		return nil
+	},
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "remove all cached archives",
+	Long: `remove all cached archives.
+Partial downloads are kept, as another setup may still be downloading them.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		cacheDir, err := util.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+
+		removed, err := util.CleanCache(cacheDir)
+		if err != nil {
+			return errors.New("Error Cleaning Download Cache. Error: " + err.Error())
+		}
+
+		var freed int64
+		for _, entry := range removed {
+			freed += entry.Size
+		}
+		fmt.Println("Removed", len(removed), "cached archives from", cacheDir+", freed", humanize.Bytes(uint64(freed)))
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove cached archives which haven't been used recently",
+	Long: `remove cached archives which haven't been used recently.
+
+Examples:
+	setup cache prune --older-than 30d
+	setup cache prune --older-than 12h
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		olderThan, err := parseAge(pruneOlderThan)
+		if err != nil {
+			return err
+		}
+
+		cacheDir, err := util.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+
+		pruned, err := util.PruneCache(cacheDir, olderThan)
+		if err != nil {
+			return errors.New("Error Pruning Download Cache. Error: " + err.Error())
+		}
+
+		var freed int64
+		for _, entry := range pruned {
+			fmt.Println("Removed", entry.Path)
+			freed += entry.Size
+		}
+		fmt.Println("Pruned", len(pruned), "cached archives, freed", humanize.Bytes(uint64(freed)))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+
+	cachePruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "30d", "remove archives not used for this long, e.g. 30d or 12h")
+}
+
+// Check if cmd is the cache command or one of its subcommands
+func isCacheCommand(cmd *cobra.Command) bool {
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if cmd == cacheCmd {
+			return true
+		}
+	}
+	return false
+}
+
+func printCacheEntries(entries []util.CacheEntry) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "FILE\tSIZE\tLAST USED\tURL")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			entry.Path,
+			humanize.Bytes(uint64(entry.Size)),
+			humanize.Time(entry.LastUsed),
+			valueOrDash(entry.Url))
+	}
+	_ = writer.Flush()
+}
+
+// Parse a duration which, in addition to the units of time.ParseDuration, may be given in days, e.g. 30d
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		count, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err != nil {
+			return 0, errors.New("Invalid age " + age + ". Use e.g. 30d or 12h")
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, errors.New("Invalid age " + age + ". Use e.g. 30d or 12h")
+	}
+	return duration, nil
+}
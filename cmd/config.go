@@ -0,0 +1,319 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"com.github/RawSanj/setup/util"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Schema version of config files which don't have a version
+const InitialConfigVersion = "1.0"
+
+// A configMigration upgrades a configuration to version. Migrations only depend on data pinned
+// to their version, never on the current defaults, so a migration always does the same
+type configMigration struct {
+	version     string
+	description string
+	migrate     func(applicationConfiguration *Configuration)
+}
+
+// Download verification settings of a default service added in config version 1.1
+type downloadSettings11 struct {
+	urlTemplate          string
+	mirrorUrlTemplates   []string
+	checksumUrlTemplate  string
+	signatureUrlTemplate string
+	keysUrl              string
+}
+
+// Settings added to the default services in 1.1, keyed by service name. urlTemplate is the
+// default of 1.0, the settings are only added to services still downloading from it
+var defaultDownloadSettings11 = map[string]downloadSettings11{
+	Kafka: {
+		urlTemplate:          "https://archive.apache.org/dist/kafka/{{.Version}}/kafka_{{.Scala}}-{{.Version}}.tgz",
+		checksumUrlTemplate:  "{{.Url}}.sha512",
+		signatureUrlTemplate: "{{.Url}}.asc",
+		keysUrl:              "https://downloads.apache.org/kafka/KEYS",
+	},
+	Cassandra: {
+		urlTemplate:          "https://downloads.apache.org/cassandra/{{.Version}}/apache-cassandra-{{.Version}}-bin.tar.gz",
+		mirrorUrlTemplates:   []string{"https://archive.apache.org/dist/cassandra/{{.Version}}/apache-cassandra-{{.Version}}-bin.tar.gz"},
+		checksumUrlTemplate:  "{{.Url}}.sha512",
+		signatureUrlTemplate: "{{.Url}}.asc",
+		keysUrl:              "https://downloads.apache.org/cassandra/KEYS",
+	},
+	DynamoDb: {
+		urlTemplate:         "https://s3.{{.Region}}.amazonaws.com/dynamodb-local{{.RegionName}}/dynamodb_local_latest.tar.gz",
+		checksumUrlTemplate: "{{.Url}}.sha256",
+	},
+}
+
+// Migrations in the order they are applied. The version of the last one is the current schema version
+var configMigrations = []configMigration{
+	{
+		version:     "1.1",
+		description: "add mirrors, checksum and signature settings to the default services",
+		migrate:     addDefaultDownloadSettings,
+	},
+}
+
+var migrateDryRun bool
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "manage the setup config file",
+	Long: `manage the setup config file.
+The config file is resolved from --config, the SETUP_CONFIG env var,
+$XDG_CONFIG_HOME/setup/config.yml or $HOME/.setup.yml, in that order.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "upgrade the config file to the current schema version",
+	Long: `upgrade the config file to the current schema version.
+Migrations add settings which are new in this version of setup to the default
+services, and keep changes made to the config file. Outdated config files are also migrated
+automatically by the other commands.
+
+Examples:
+	setup config migrate --dry-run
+	setup config migrate
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		configFile := viper.ConfigFileUsed()
+		oldContent, newContent, migrations, err := planConfigMigration(configFile)
+		if err != nil {
+			return err
+		}
+		if newContent == nil {
+			fmt.Println("Config file", configFile, "is up to date at version", currentConfigVersion())
+			return nil
+		}
+
+		printMigrations(os.Stdout, migrations)
+		if migrateDryRun {
+			return printConfigDiff(configFile, oldContent, newContent)
+		}
+
+		_, err = applyConfigMigration(cmd.Context())
+		if err != nil {
+			return err
+		}
+		fmt.Println("Migrated config file", configFile, "to version", currentConfigVersion())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "show the changes to the config file without writing them")
+}
+
+func currentConfigVersion() string {
+	return configMigrations[len(configMigrations)-1].version
+}
+
+// Return the schema version stored under the version key of the config file
+func documentVersion(value interface{}) string {
+	switch version := value.(type) {
+	case string:
+		return version
+	case float64:
+		// An unquoted version like 1.1 is read as a number
+		return strconv.FormatFloat(version, 'f', 1, 64)
+	case int:
+		return strconv.Itoa(version) + ".0"
+	}
+	return InitialConfigVersion
+}
+
+// Return the migrations which upgrade a config file of version to the current version
+func pendingMigrations(version string) ([]configMigration, error) {
+	if version == InitialConfigVersion {
+		return configMigrations, nil
+	}
+	for i, migration := range configMigrations {
+		if migration.version == version {
+			return configMigrations[i+1:], nil
+		}
+	}
+	return nil, fmt.Errorf("config file version %s isn't supported by this version of setup, which supports versions up to %s. Please upgrade setup", version, currentConfigVersion())
+}
+
+// Fail for config files of a newer, unknown version which this version of setup can't read correctly
+func checkConfigVersion() error {
+	document, err := readConfigDocument(viper.ConfigFileUsed())
+	if err != nil {
+		return err
+	}
+	version, _ := documentValue(document, ConfigVersionKey)
+	_, err = pendingMigrations(documentVersion(version))
+	return err
+}
+
+// Work out the migrated content of configFile. newContent is nil when configFile is up to date.
+// Config files storing the configuration as a YAML string are rewritten as nested YAML too
+func planConfigMigration(configFile string) (oldContent []byte, newContent []byte, migrations []configMigration, err error) {
+
+	oldContent, err = os.ReadFile(configFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	document, err := readConfigDocument(configFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	version, _ := documentValue(document, ConfigVersionKey)
+	migrations, err = pendingMigrations(documentVersion(version))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	configuration, _ := documentValue(document, ConfigurationKey)
+	_, isString := configuration.(string)
+	if len(migrations) == 0 && !isString {
+		return oldContent, nil, nil, nil
+	}
+
+	applicationConfiguration, err := loadApplicationConfiguration(configFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, migration := range migrations {
+		migration.migrate(&applicationConfiguration)
+	}
+
+	newContent, err = configDocumentContent(configFile, &applicationConfiguration, currentConfigVersion())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return oldContent, newContent, migrations, nil
+}
+
+// Migrate the config file while holding the config file lock, returning the applied migrations
+func applyConfigMigration(ctx context.Context) ([]configMigration, error) {
+	lock, err := lockApplicationConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	configFile := viper.ConfigFileUsed()
+	_, newContent, migrations, err := planConfigMigration(configFile)
+	if err != nil || newContent == nil {
+		return nil, err
+	}
+
+	err = util.WriteFileAtomic(configFile, newContent, 0644)
+	if err != nil {
+		return nil, errors.New("Error Writing Config File. Error: " + err.Error())
+	}
+	return migrations, nil
+}
+
+// Migrate an outdated config file before running a command
+func migrateConfigFile(ctx context.Context) error {
+	_, newContent, _, err := planConfigMigration(viper.ConfigFileUsed())
+	if err != nil || newContent == nil {
+		return err
+	}
+
+	migrations, err := applyConfigMigration(ctx)
+	if err != nil {
+		return err
+	}
+	// stderr, so the output of commands like list -o json stays parseable
+	fmt.Fprintln(os.Stderr, "Migrated config file", viper.ConfigFileUsed(), "to version", currentConfigVersion())
+	printMigrations(os.Stderr, migrations)
+	return nil
+}
+
+func printMigrations(out *os.File, migrations []configMigration) {
+	for _, migration := range migrations {
+		fmt.Fprintf(out, "\t%s: %s\n", migration.version, migration.description)
+	}
+}
+
+func printConfigDiff(configFile string, oldContent []byte, newContent []byte) error {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(oldContent)),
+		B:        difflib.SplitLines(string(newContent)),
+		FromFile: configFile,
+		ToFile:   configFile + " (migrated)",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+// Migration to 1.1. Default services which still download from their 1.0 urlTemplate get the
+// mirrors, checksum and signature settings they are missing. Only empty settings are filled in.
+// The default services and versions are the same in 1.0 and 1.1, so none are added: services
+// and versions the user removed stay removed, and everything else is kept as it is
+func addDefaultDownloadSettings(applicationConfiguration *Configuration) {
+
+	for name, settings := range defaultDownloadSettings11 {
+		service, exists := applicationConfiguration.Services[name]
+		if !exists || service.UrlTemplate != settings.urlTemplate {
+			continue
+		}
+
+		if len(service.MirrorUrlTemplates) == 0 {
+			service.MirrorUrlTemplates = settings.mirrorUrlTemplates
+		}
+		if service.ChecksumUrlTemplate == "" {
+			service.ChecksumUrlTemplate = settings.checksumUrlTemplate
+		}
+		if service.SignatureUrlTemplate == "" && service.KeysFile == "" {
+			service.SignatureUrlTemplate = settings.signatureUrlTemplate
+			if service.KeysUrl == "" {
+				service.KeysUrl = settings.keysUrl
+			}
+		}
+
+		applicationConfiguration.Services[name] = service
+	}
+}
@@ -0,0 +1,377 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Editor used by config edit when EDITOR isn't set
+const DefaultEditor = "vi"
+
+// Shown at the top of the file opened by config edit
+const configEditHeader = `# Edit the configuration of setup and close the editor to save it. The configuration
+# is validated before saving, like setup config validate does. Leave the file unchanged
+# to cancel.
+`
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "print a setting of the configuration",
+	Long: `print a setting of the configuration.
+Keys are the path to a setting in the configuration section of the config file, joined
+with dots. Settings with nested values are printed as YAML.
+
+Examples:
+	setup config get services.kafka.defaultVersion
+	setup config get services.cassandra
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		applicationConfiguration, err := loadApplicationConfiguration(viper.ConfigFileUsed())
+		if err != nil {
+			return err
+		}
+		root, err := configurationNode(&applicationConfiguration)
+		if err != nil {
+			return err
+		}
+
+		path := strings.Split(args[0], ".")
+		node, matched := lookupConfigNode(root, path)
+		if matched < len(path) {
+			return errors.New("key " + args[0] + " not found in the configuration")
+		}
+
+		if node.Kind == yamlv3.ScalarNode {
+			fmt.Println(node.Value)
+			return nil
+		}
+		content, err := yamlv3.Marshal(node)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(content))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "change a setting of the configuration",
+	Long: `change a setting of the configuration.
+Keys are the path to a setting in the configuration section of the config file, joined
+with dots, see config get. The value is read as YAML, so lists and nested settings can
+be set too. Quote templates inside lists, as {{ starts a mapping in YAML. A key which
+doesn't exist yet is added to the deepest existing key of its path. The configuration
+is validated before it's saved.
+
+Examples:
+	setup config set services.cassandra.enabled false
+	setup config set services.kafka.path ~/tools/kafka
+	setup config set services.kafka.mirrorUrlTemplates '["https://mirror.example.com/kafka/{{.Version}}/kafka_{{.Scala}}-{{.Version}}.tgz"]'
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile := viper.ConfigFileUsed()
+		err := updateApplicationConfiguration(cmd.Context(), func(applicationConfiguration *Configuration) error {
+			updatedConfiguration, err := setConfigValue(applicationConfiguration, args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			content, err := configDocumentContent(configFile, &updatedConfiguration, "")
+			if err != nil {
+				return err
+			}
+			if problems := validateConfigurationContent(&updatedConfiguration, content); len(problems) > 0 {
+				return configProblemsErrorf(configFile, problems, "Not setting %s, the config file would have %d error(s):", args[0], len(problems))
+			}
+
+			*applicationConfiguration = updatedConfiguration
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Set", args[0], "in", configFile)
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "edit the configuration in $EDITOR",
+	Long: `edit the configuration in $EDITOR, or ` + DefaultEditor + ` when EDITOR isn't set.
+The configuration is saved when the editor is closed. When it doesn't parse or isn't
+valid, the errors are shown and the editor is opened again to fix them. Other setup
+processes wait for the edit to finish before changing the config file.
+
+Examples:
+	setup config edit
+	EDITOR="code --wait" setup config edit
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lock, err := lockApplicationConfiguration(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		configFile := viper.ConfigFileUsed()
+		applicationConfiguration, err := loadApplicationConfiguration(configFile)
+		if err != nil {
+			return err
+		}
+
+		edited, changed, err := editConfiguration(&applicationConfiguration)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Println("Configuration not changed")
+			return nil
+		}
+
+		err = saveApplicationConfiguration(&edited)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Saved configuration to", configFile)
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configEditCmd)
+}
+
+// Return applicationConfiguration as a YAML node, with its settings in the order of the config file
+func configurationNode(applicationConfiguration *Configuration) (*yamlv3.Node, error) {
+	content, err := yaml.Marshal(applicationConfiguration)
+	if err != nil {
+		return nil, errors.New("Error Marshalling Configuration. Error: " + err.Error())
+	}
+
+	var document yamlv3.Node
+	err = yamlv3.Unmarshal(content, &document)
+	if err != nil {
+		return nil, err
+	}
+	return document.Content[0], nil
+}
+
+// Follow path from node through mappings and sequences, returning the deepest node found and the
+// number of path elements leading to it. Keys may contain dots themselves, like version names, so
+// the longest key matching the path is followed
+func lookupConfigNode(node *yamlv3.Node, path []string) (*yamlv3.Node, int) {
+	matched := 0
+	for matched < len(path) {
+		next, elements := childConfigNode(node, path[matched:])
+		if next == nil {
+			break
+		}
+		node = next
+		matched += elements
+	}
+	return node, matched
+}
+
+func childConfigNode(node *yamlv3.Node, path []string) (*yamlv3.Node, int) {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for elements := len(path); elements > 0; elements-- {
+			key := strings.Join(path[:elements], ".")
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					return node.Content[i+1], elements
+				}
+			}
+		}
+	case yamlv3.SequenceNode:
+		index, err := strconv.Atoi(path[0])
+		if err == nil && index >= 0 && index < len(node.Content) {
+			return node.Content[index], 1
+		}
+	}
+	return nil, 0
+}
+
+// Return a copy of applicationConfiguration with key set to value, which is parsed as YAML
+func setConfigValue(applicationConfiguration *Configuration, key string, value string) (Configuration, error) {
+	root, err := configurationNode(applicationConfiguration)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	valueNode := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str"}
+	var valueDocument yamlv3.Node
+	err = yamlv3.Unmarshal([]byte(value), &valueDocument)
+	if err != nil {
+		return Configuration{}, errors.New("Error Parsing Value " + value + ". Error: " + err.Error())
+	}
+	if len(valueDocument.Content) > 0 {
+		valueNode = valueDocument.Content[0]
+	}
+
+	path := strings.Split(key, ".")
+	node, matched := lookupConfigNode(root, path)
+	if matched == len(path) {
+		*node = *valueNode
+	} else if node.Kind == yamlv3.MappingNode {
+		keyNode := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: strings.Join(path[matched:], ".")}
+		node.Content = append(node.Content, keyNode, valueNode)
+	} else {
+		return Configuration{}, errors.New("can't add key " + key + ", " + strings.Join(path[:matched], ".") + " doesn't have keys")
+	}
+
+	content, err := yamlv3.Marshal(root)
+	if err != nil {
+		return Configuration{}, err
+	}
+	updatedConfiguration := Configuration{}
+	err = yaml.UnmarshalStrict(content, &updatedConfiguration)
+	if typeError, isTypeError := err.(*yaml.TypeError); isTypeError {
+		// The lines refer to the configuration as marshalled here rather than the config file
+		messages := make([]string, len(typeError.Errors))
+		for i, message := range typeError.Errors {
+			_, messages[i], _ = strings.Cut(message, ": ")
+		}
+		return Configuration{}, errors.New("Error Setting " + key + ". Error: " + strings.Join(messages, ", "))
+	} else if err != nil {
+		return Configuration{}, errors.New("Error Setting " + key + ". Error: " + err.Error())
+	}
+	return updatedConfiguration, nil
+}
+
+// Open applicationConfiguration in the editor until it's saved valid or left unchanged. Returns
+// the edited configuration and whether it was changed
+func editConfiguration(applicationConfiguration *Configuration) (Configuration, bool, error) {
+
+	content, err := yaml.Marshal(yaml.MapSlice{{Key: ConfigurationKey, Value: applicationConfiguration}})
+	if err != nil {
+		return Configuration{}, false, errors.New("Error Marshalling Configuration. Error: " + err.Error())
+	}
+	content = append([]byte(configEditHeader), content...)
+
+	editFile, err := os.CreateTemp("", "setup-config-*.yml")
+	if err != nil {
+		return Configuration{}, false, err
+	}
+	defer os.Remove(editFile.Name())
+	_, err = editFile.Write(content)
+	if closeErr := editFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Configuration{}, false, err
+	}
+
+	for {
+		err = runEditor(editFile.Name())
+		if err != nil {
+			return Configuration{}, false, err
+		}
+		edited, err := os.ReadFile(editFile.Name())
+		if err != nil {
+			return Configuration{}, false, err
+		}
+		if bytes.Equal(edited, content) {
+			return Configuration{}, false, nil
+		}
+
+		editedConfiguration, err := parseEditedConfiguration(editFile.Name(), edited)
+		if err == nil {
+			return editedConfiguration, true, nil
+		}
+
+		// Without a terminal to ask on, fail rather than discarding the edit silently
+		if !isInteractive() {
+			return Configuration{}, false, err
+		}
+		fmt.Println(err)
+		editAgain := true
+		err = survey.AskOne(&survey.Confirm{Message: "Edit the configuration again?", Default: true}, &editAgain)
+		if err != nil {
+			return Configuration{}, false, err
+		}
+		if !editAgain {
+			return Configuration{}, false, errors.New("configuration not saved, the edit is discarded")
+		}
+	}
+}
+
+// Decode and validate the content of the file edited by config edit
+func parseEditedConfiguration(editFile string, content []byte) (Configuration, error) {
+	var edited struct {
+		Configuration *Configuration `yaml:"configuration"`
+	}
+	err := yaml.UnmarshalStrict(content, &edited)
+	if err != nil {
+		return Configuration{}, errors.New("Error Parsing " + editFile + ". Error: " + err.Error())
+	}
+	if edited.Configuration == nil {
+		return Configuration{}, errors.New("Error Parsing " + editFile + ". Error: the " + ConfigurationKey + " key is missing")
+	}
+
+	if problems := validateConfigurationContent(edited.Configuration, content); len(problems) > 0 {
+		return Configuration{}, configProblemsErrorf(editFile, problems, "%d error(s) in the edited configuration:", len(problems))
+	}
+	return *edited.Configuration, nil
+}
+
+// Run EDITOR on fileName with the terminal attached. EDITOR can include arguments, like "code --wait"
+func runEditor(fileName string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{DefaultEditor}
+	}
+
+	editorCmd := exec.Command(editor[0], append(editor[1:], fileName)...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	err := editorCmd.Run()
+	if err != nil {
+		return errors.New("Error Running Editor " + strings.Join(editor, " ") + ". Error: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupConfigNodeDottedKeys(t *testing.T) {
+	configuration := createApplicationConfig(t.TempDir())
+	root, err := configurationNode(&configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		value string
+		found bool
+	}{
+		{"services.kafka.defaultVersion", "kafka-2.13-2.5.0", true},
+		// Version names contain dots, the longest matching key is followed
+		{"services.kafka.availableVersions.kafka-2.13-2.5.0.Scala", "2.13", true},
+		{"services.cassandra.availableVersions.v3.11.7.Version", "3.11.7", true},
+		{"services.cassandra.mirrorUrlTemplates.0", configuration.Services[Cassandra].MirrorUrlTemplates[0], true},
+		{"services.cassandra.mirrorUrlTemplates.1", "", false},
+		{"services.kafka.availableVersions.kafka-2.13-9.9.9", "", false},
+		{"services.redis", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			path := strings.Split(tt.key, ".")
+			node, matched := lookupConfigNode(root, path)
+			if found := matched == len(path); found != tt.found {
+				t.Fatalf("expected found %v, matched %d of %d elements", tt.found, matched, len(path))
+			}
+			if tt.found && node.Value != tt.value {
+				t.Errorf("expected %q, got %q", tt.value, node.Value)
+			}
+		})
+	}
+}
+
+func TestSetConfigValue(t *testing.T) {
+	configuration := createApplicationConfig(t.TempDir())
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		check func(updated Configuration) interface{}
+		want  interface{}
+	}{
+		{
+			name:  "dotted version key",
+			key:   "services.kafka.availableVersions.kafka-2.13-2.5.0.Version",
+			value: "2.5.1",
+			check: func(updated Configuration) interface{} {
+				return updated.Services[Kafka].Versions["kafka-2.13-2.5.0"]["Version"]
+			},
+			want: "2.5.1",
+		},
+		{
+			name:  "new dotted version key",
+			key:   "services.kafka.availableVersions.kafka-2.13-2.6.0",
+			value: "{Name: kafka-2.13-2.6.0, Scala: '2.13', Version: 2.6.0}",
+			check: func(updated Configuration) interface{} {
+				return updated.Services[Kafka].Versions["kafka-2.13-2.6.0"]
+			},
+			want: VersionMap{"Name": "kafka-2.13-2.6.0", "Scala": "2.13", "Version": "2.6.0"},
+		},
+		{
+			name:  "list",
+			key:   "services.kafka.mirrorUrlTemplates",
+			value: `["https://mirror.example.com/kafka/{{.Version}}.tgz"]`,
+			check: func(updated Configuration) interface{} {
+				return updated.Services[Kafka].MirrorUrlTemplates
+			},
+			want: []string{"https://mirror.example.com/kafka/{{.Version}}.tgz"},
+		},
+		{
+			name:  "list element",
+			key:   "services.cassandra.mirrorUrlTemplates.0",
+			value: "https://mirror.example.com/cassandra/{{.Version}}.tar.gz",
+			check: func(updated Configuration) interface{} {
+				return updated.Services[Cassandra].MirrorUrlTemplates
+			},
+			want: []string{"https://mirror.example.com/cassandra/{{.Version}}.tar.gz"},
+		},
+		{
+			name:  "bool",
+			key:   "services.dynamodb.enabled",
+			value: "false",
+			check: func(updated Configuration) interface{} {
+				return updated.Services[DynamoDb].IsEnabled
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := setConfigValue(&configuration, tt.key, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.check(updated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+			if got := tt.check(configuration); reflect.DeepEqual(got, tt.want) {
+				t.Error("the configuration set on was changed too")
+			}
+		})
+	}
+}
+
+func TestSetConfigValueErrors(t *testing.T) {
+	configuration := createApplicationConfig(t.TempDir())
+
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr string
+	}{
+		{name: "wrong type", key: "services.kafka.enabled", value: "[true]", wantErr: "Error Setting services.kafka.enabled"},
+		{name: "unknown setting", key: "services.kafka.unknownSetting", value: "x", wantErr: "not found in type cmd.Service"},
+		{name: "key under a value", key: "services.kafka.name.first", value: "x", wantErr: "services.kafka.name doesn't have keys"},
+		{name: "invalid yaml", key: "services.kafka.name", value: "[kafka", wantErr: "Error Parsing Value"},
+		{name: "unquoted template in a list", key: "services.kafka.mirrorUrlTemplates", value: "[https://mirror.example.com/{{.Version}}.tgz]", wantErr: "Error Parsing Value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := setConfigValue(&configuration, tt.key, tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetConfigValueRevalidation(t *testing.T) {
+	configuration := createApplicationConfig(t.TempDir())
+
+	// Setting a value of the right type succeeds, but config set refuses to save a configuration
+	// with problems
+	updated, err := setConfigValue(&configuration, "services.kafka.defaultVersion", "kafka-2.13-9.9.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := configDocumentContent(filepath.Join(t.TempDir(), XdgConfigFileName), &updated, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := validateConfigurationContent(&updated, content)
+	if len(problems) != 1 || problems[0].key != "services.kafka.defaultVersion" || problems[0].line == 0 {
+		t.Fatalf("expected a problem with services.kafka.defaultVersion, got %+v", problems)
+	}
+}
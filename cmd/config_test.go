@@ -0,0 +1,163 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Write a config file like setup 1.0 did, with the configuration as a YAML string
+func writeStringConfigFile(t *testing.T, applicationConfiguration *Configuration) string {
+	configurationString, err := yaml.Marshal(applicationConfiguration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := yaml.Marshal(yaml.MapSlice{
+		{Key: "application", Value: "setup is a cli tool written in Go to download and install development services."},
+		{Key: ConfigurationKey, Value: string(configurationString)},
+		{Key: ConfigVersionKey, Value: InitialConfigVersion},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(t.TempDir(), LegacyConfigFileName)
+	if err = os.WriteFile(configFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestMigrateStringConfigFile(t *testing.T) {
+	home := t.TempDir()
+	configuration := createApplicationConfig(home)
+	// An empty installedVersion is written as [] and read back as an empty slice
+	for name, service := range configuration.Services {
+		service.InstalledVersion = []string{}
+		configuration.Services[name] = service
+	}
+	kafka := configuration.Services[Kafka]
+	kafka.InstalledVersion = []string{"kafka-2.13-2.5.0"}
+	kafka.ActiveVersion = "kafka-2.13-2.5.0"
+	configuration.Services[Kafka] = kafka
+	configFile := writeStringConfigFile(t, &configuration)
+
+	loaded, err := loadApplicationConfiguration(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, configuration) {
+		t.Fatal("the configuration string wasn't decoded to the configuration it was written from")
+	}
+
+	_, newContent, migrations, err := planConfigMigration(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newContent == nil || len(migrations) != len(configMigrations) {
+		t.Fatalf("expected all %d migrations to be planned, got %d", len(configMigrations), len(migrations))
+	}
+	if err = os.WriteFile(configFile, newContent, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := readConfigDocument(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := documentValue(document, ConfigurationKey); reflect.TypeOf(value) == reflect.TypeOf("") {
+		t.Error("the migrated configuration is still a YAML string")
+	}
+	if value, _ := documentValue(document, ConfigVersionKey); documentVersion(value) != currentConfigVersion() {
+		t.Errorf("expected version %s, got %v", currentConfigVersion(), value)
+	}
+	if value, _ := documentValue(document, "application"); value == nil {
+		t.Error("the application key of the config file was dropped")
+	}
+
+	migrated, err := loadApplicationConfiguration(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range configMigrations {
+		migration.migrate(&configuration)
+	}
+	if !reflect.DeepEqual(migrated, configuration) {
+		t.Error("the migrated config file doesn't decode to the migrated configuration")
+	}
+
+	// A migrated config file is up to date
+	_, newContent, _, err = planConfigMigration(configFile)
+	if err != nil || newContent != nil {
+		t.Errorf("expected no more migrations, got %v", err)
+	}
+}
+
+func TestAddDefaultDownloadSettingsKeepsUserEdits(t *testing.T) {
+	applicationConfiguration := Configuration{
+		Info: "my own notes",
+		Services: map[string]Service{
+			Kafka: {
+				Name:        Kafka,
+				UrlTemplate: defaultDownloadSettings11[Kafka].urlTemplate,
+				KeysUrl:     "https://keys.internal/kafka/KEYS",
+				Versions:    map[string]VersionMap{"kafka-2.13-2.5.0": {"Name": "kafka-2.13-2.5.0", "Scala": "2.13", "Version": "2.5.0"}},
+			},
+			Cassandra: {
+				Name:        Cassandra,
+				UrlTemplate: "https://mirror.internal/cassandra/{{.Version}}.tar.gz",
+			},
+		},
+	}
+
+	addDefaultDownloadSettings(&applicationConfiguration)
+
+	if applicationConfiguration.Info != "my own notes" {
+		t.Errorf("Info was changed to %q", applicationConfiguration.Info)
+	}
+	if _, exists := applicationConfiguration.Services[DynamoDb]; exists {
+		t.Error("removed service " + DynamoDb + " was added back")
+	}
+
+	kafka := applicationConfiguration.Services[Kafka]
+	if len(kafka.Versions) != 1 {
+		t.Errorf("removed versions of %s were added back, found %d versions", Kafka, len(kafka.Versions))
+	}
+	if kafka.ChecksumUrlTemplate == "" || kafka.SignatureUrlTemplate == "" {
+		t.Errorf("%s using the default urlTemplate didn't get the download settings: %+v", Kafka, kafka)
+	}
+	if kafka.KeysUrl != "https://keys.internal/kafka/KEYS" {
+		t.Errorf("customized keysUrl of %s was changed to %s", Kafka, kafka.KeysUrl)
+	}
+
+	cassandra := applicationConfiguration.Services[Cassandra]
+	if cassandra.ChecksumUrlTemplate != "" || len(cassandra.MirrorUrlTemplates) != 0 {
+		t.Errorf("%s using its own urlTemplate got the default download settings: %+v", Cassandra, cassandra)
+	}
+}
@@ -0,0 +1,369 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"com.github/RawSanj/setup/util"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A configProblem is an error in the config file found by validateConfigFile
+type configProblem struct {
+	line    int
+	key     string
+	message string
+}
+
+// A url template of a service. Templates withUrl can refer to the download url as {{.Url}}
+type serviceTemplate struct {
+	key     string
+	text    string
+	withUrl bool
+}
+
+// Finds the line of keys in the config file, to point problems at the line to fix
+type configLocator struct {
+	configuration *yamlv3.Node
+	// Added to the lines of configuration, which is parsed from a YAML string in config
+	// files of earlier versions
+	lineOffset int
+	line       int
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check the config file for errors",
+	Long: `check the config file for errors.
+Checks that the url templates of every service parse and render for all its
+availableVersions, that defaultVersion and activeVersion are available versions,
+and that the path of every enabled service is writable. Errors are reported with
+their line in the config file. The other commands validate the config file before
+running too, warning about the problems found. Only install fails for problems
+of the services it installs, and checks their paths.
+
+Example:
+	setup config validate
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile := viper.ConfigFileUsed()
+		problems, err := validateConfigFile(configFile, true)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return configProblemsError(configFile, problems)
+		}
+
+		fmt.Println("Config file", configFile, "is valid")
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
+
+// Warn about all problems of the config file before running a command. A broken service doesn't
+// stop commands for other services, or the commands fixing it, so commands fail only for problems
+// of the services they use, like install does with checkValidServices.
+// Paths aren't checked, commands check the paths of the services they write to themselves
+func warnInvalidConfigFile() error {
+	configFile := viper.ConfigFileUsed()
+	problems, err := validateConfigFile(configFile, false)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		// stderr, so the output of commands like list -o json stays parseable
+		fmt.Fprintln(os.Stderr, "Warning:", configProblemsError(configFile, problems))
+	}
+	return nil
+}
+
+// Fail with the problems of serviceNames in the config file, before a command uses them
+func checkValidServices(serviceNames []string) error {
+	configFile := viper.ConfigFileUsed()
+	problems, err := validateConfigFile(configFile, false)
+	if err != nil {
+		return err
+	}
+	problems = serviceConfigProblems(problems, serviceNames)
+	if len(problems) > 0 {
+		return configProblemsError(configFile, problems)
+	}
+	return nil
+}
+
+// Return the problems found in the settings of serviceNames
+func serviceConfigProblems(problems []configProblem, serviceNames []string) []configProblem {
+	var serviceProblems []configProblem
+	for _, problem := range problems {
+		for _, name := range serviceNames {
+			if problem.key == "services."+name || strings.HasPrefix(problem.key, "services."+name+".") {
+				serviceProblems = append(serviceProblems, problem)
+				break
+			}
+		}
+	}
+	return serviceProblems
+}
+
+func configProblemsError(configFile string, problems []configProblem) error {
+	return configProblemsErrorf(configFile, problems, "%d error(s) in config file %s:", len(problems), configFile)
+}
+
+// List problems found in fileName below a heading
+func configProblemsErrorf(fileName string, problems []configProblem, heading string, a ...interface{}) error {
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf(heading, a...))
+	for _, problem := range problems {
+		message.WriteString("\n\t" + fileName + ":" + strconv.Itoa(problem.line) + ": " + problem.key + ": " + problem.message)
+	}
+	return errors.New(message.String())
+}
+
+// Validate the configuration of configFile, and with checkPaths that the path of every enabled
+// service is writable. Returns an error when the config file can't be read at all, and the
+// problems found in it otherwise, ordered by line
+func validateConfigFile(configFile string, checkPaths bool) ([]configProblem, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	applicationConfiguration, err := loadApplicationConfiguration(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := validateConfigurationContent(&applicationConfiguration, content)
+	if checkPaths {
+		problems = append(problems, validateInstallationPaths(&applicationConfiguration, newConfigLocator(content))...)
+		sortConfigProblems(problems)
+	}
+	return problems, nil
+}
+
+// Validate applicationConfiguration decoded from the YAML content, returning the problems ordered by line
+func validateConfigurationContent(applicationConfiguration *Configuration, content []byte) []configProblem {
+	problems := validateConfiguration(applicationConfiguration, newConfigLocator(content))
+	sortConfigProblems(problems)
+	return problems
+}
+
+func sortConfigProblems(problems []configProblem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].line < problems[j].line
+	})
+}
+
+func validateConfiguration(applicationConfiguration *Configuration, locator configLocator) []configProblem {
+	var problems []configProblem
+
+	serviceNames := make([]string, 0, len(applicationConfiguration.Services))
+	for name := range applicationConfiguration.Services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+
+	for _, name := range serviceNames {
+		service := applicationConfiguration.Services[name]
+		report := func(message string, keys ...string) {
+			keys = append([]string{"services", name}, keys...)
+			problems = append(problems, configProblem{
+				line:    locator.lineOf(keys...),
+				key:     strings.Join(keys, "."),
+				message: message,
+			})
+		}
+
+		if service.Type != "" && service.Type != ArchiveServiceType && service.Type != BinaryServiceType {
+			report("unknown type "+service.Type+", must be "+ArchiveServiceType+" or "+BinaryServiceType, "type")
+		}
+		if service.UrlTemplate == "" {
+			report("urlTemplate is empty", "urlTemplate")
+		}
+
+		if len(service.Versions) == 0 {
+			report("no versions are available", "availableVersions")
+		}
+		if _, exists := service.Versions[service.SelectedVersion]; !exists {
+			report("version "+strconv.Quote(service.SelectedVersion)+" is not in availableVersions", "defaultVersion")
+		}
+		if _, exists := service.Versions[service.ActiveVersion]; service.ActiveVersion != "" && !exists {
+			report("version "+strconv.Quote(service.ActiveVersion)+" is not in availableVersions", "activeVersion")
+		}
+
+		validateTemplates(service, report)
+
+		// Disabled services are never installed, so their path doesn't need to exist
+		if service.IsEnabled && service.InstallationPath == "" {
+			report("path is empty", "path")
+		}
+	}
+	return problems
+}
+
+// Check the path of every enabled service is writable
+func validateInstallationPaths(applicationConfiguration *Configuration, locator configLocator) []configProblem {
+	serviceNames := make([]string, 0, len(applicationConfiguration.Services))
+	for name := range applicationConfiguration.Services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+
+	var problems []configProblem
+	for _, name := range serviceNames {
+		service := applicationConfiguration.Services[name]
+		if !service.IsEnabled || service.InstallationPath == "" {
+			continue
+		}
+		if err := util.CheckWritableDir(service.InstallationPath); err != nil {
+			problems = append(problems, configProblem{
+				line:    locator.lineOf("services", name, "path"),
+				key:     "services." + name + ".path",
+				message: err.Error(),
+			})
+		}
+	}
+	return problems
+}
+
+// Parse the url templates of service and render them for each of its versions, like install does
+func validateTemplates(service Service, report func(message string, keys ...string)) {
+
+	versions := make([]string, 0, len(service.Versions))
+	for version := range service.Versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	templates := []serviceTemplate{
+		{"urlTemplate", service.UrlTemplate, false},
+		{"checksumUrlTemplate", service.ChecksumUrlTemplate, true},
+		{"signatureUrlTemplate", service.SignatureUrlTemplate, true},
+	}
+	for _, mirrorUrlTemplate := range service.MirrorUrlTemplates {
+		templates = append(templates, serviceTemplate{"mirrorUrlTemplates", mirrorUrlTemplate, false})
+	}
+
+	for _, urlTemplate := range templates {
+		if urlTemplate.text == "" {
+			continue
+		}
+		t, err := template.New(urlTemplate.key).Option("missingkey=error").Parse(urlTemplate.text)
+		if err != nil {
+			report(err.Error(), urlTemplate.key)
+			continue
+		}
+
+		// A template referring to a key most versions lack is reported once rather than for every version
+		var renderErrors []string
+		failedVersions := make(map[string][]string)
+		for _, version := range versions {
+			templateData := service.Versions[version]
+			if urlTemplate.withUrl {
+				templateData = withUrl(templateData, "")
+			}
+			if err = t.Execute(io.Discard, templateData); err != nil {
+				if _, exists := failedVersions[err.Error()]; !exists {
+					renderErrors = append(renderErrors, err.Error())
+				}
+				failedVersions[err.Error()] = append(failedVersions[err.Error()], version)
+			}
+		}
+
+		for _, renderError := range renderErrors {
+			failed := failedVersions[renderError]
+			if len(failed) == 1 {
+				report(urlTemplate.key+" can't be rendered for this version: "+renderError, "availableVersions", failed[0])
+			} else {
+				report(fmt.Sprintf("can't be rendered for version %s and %d other versions: %s", failed[0], len(failed)-1, renderError), urlTemplate.key)
+			}
+		}
+	}
+}
+
+func newConfigLocator(content []byte) configLocator {
+	var document yamlv3.Node
+	if yamlv3.Unmarshal(content, &document) != nil || len(document.Content) == 0 {
+		return configLocator{}
+	}
+
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != ConfigurationKey {
+			continue
+		}
+		locator := configLocator{configuration: root.Content[i+1], line: root.Content[i].Line}
+		if locator.configuration.Kind != yamlv3.ScalarNode {
+			return locator
+		}
+
+		// The lines of a configuration string only match the file when it's a block scalar,
+		// which starts on the line after the key
+		var configuration yamlv3.Node
+		isBlock := locator.configuration.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0
+		if !isBlock || yamlv3.Unmarshal([]byte(locator.configuration.Value), &configuration) != nil || len(configuration.Content) == 0 {
+			return configLocator{line: locator.line}
+		}
+		return configLocator{configuration: configuration.Content[0], lineOffset: locator.line, line: locator.line}
+	}
+	return configLocator{}
+}
+
+// Return the line of the deepest of keys found under the configuration key
+func (l configLocator) lineOf(keys ...string) int {
+	line := l.line
+	node := l.configuration
+	for _, key := range keys {
+		if node == nil || node.Kind != yamlv3.MappingNode {
+			break
+		}
+		var value *yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line + l.lineOffset
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			break
+		}
+		node = value
+	}
+	return line
+}
@@ -0,0 +1,110 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The configuration of the tests, with an empty urlTemplate on line 5 and an unknown defaultVersion
+// on line 11 of the configuration
+const invalidConfiguration = `info: test
+services:
+  kafka:
+    name: kafka
+    urlTemplate: ""
+    path: /opt/kafka
+    enabled: false
+    availableVersions:
+      kafka-2.13-2.5.0:
+        Name: kafka-2.13-2.5.0
+    defaultVersion: kafka-2.13-9.9.9
+`
+
+// Indent the lines of content by indent spaces
+func indentLines(content string, indent int) string {
+	lines := strings.SplitAfter(content, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = strings.Repeat(" ", indent) + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func TestValidateConfigFileLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lines   []int
+	}{
+		{
+			name:    "nested",
+			content: "application: setup\nconfiguration:\n" + indentLines(invalidConfiguration, 2) + "version: \"1.1\"\n",
+			lines:   []int{7, 13},
+		},
+		{
+			name:    "block scalar string",
+			content: "application: setup\nconfiguration: |\n" + indentLines(invalidConfiguration, 2) + "version: \"1.0\"\n",
+			lines:   []int{7, 13},
+		},
+		{
+			name:    "block scalar string after other keys",
+			content: "application: setup\nextractMaxSize: 1GB\n\nconfiguration: |-\n" + indentLines(invalidConfiguration, 4) + "version: \"1.0\"\n",
+			lines:   []int{9, 15},
+		},
+		{
+			// The lines of a quoted string don't match the file, so problems point at the configuration key
+			name:    "quoted string",
+			content: "application: setup\nconfiguration: " + strconv.Quote(invalidConfiguration) + "\nversion: \"1.0\"\n",
+			lines:   []int{2, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), XdgConfigFileName)
+			if err := os.WriteFile(configFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, err := validateConfigFile(configFile, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.lines) {
+				t.Fatalf("expected %d problems, got %+v", len(tt.lines), problems)
+			}
+			keys := []string{"services.kafka.urlTemplate", "services.kafka.defaultVersion"}
+			for i, problem := range problems {
+				if problem.key != keys[i] || problem.line != tt.lines[i] {
+					t.Errorf("expected %s on line %d, got %s on line %d", keys[i], tt.lines[i], problem.key, problem.line)
+				}
+			}
+		})
+	}
+}
@@ -27,13 +27,20 @@ package cmd
 import (
 	"bytes"
 	"com.github/RawSanj/setup/util"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/dustin/go-humanize"
+	"github.com/gofrs/flock"
 	"github.com/spf13/viper"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/spf13/cobra"
@@ -46,12 +53,38 @@ type UrlHolder struct {
 	Scala   string
 }
 
+var acceptDefaults bool
+var archiveFlags []string
+var parallelInstalls int
+
 // installCmd represents the install command
 var installCmd = &cobra.Command{
-	Use:   "install",
+	Use:   "install [service[@version]]...",
 	Short: "install all or select services which you want to be installed",
 	Long: `install all or select services which you want to be installed
 Currently supports various versions of Kafka, Cassandra and DynamoDb.
+
+Services can be passed as arguments to install without any prompts. When no
+version is given the default version of the service is installed.
+
+Downloads are verified against the Checksum of the version, or against the
+checksum file of checksumUrlTemplate, which can refer to the download url as {{.Url}}.
+
+Transient download failures are retried, after which the mirrorUrlTemplates
+of the service are tried in order.
+
+Services with type binary are single executables installed as bin/<binaryName>,
+where binaryName defaults to the service name.
+
+Archives with a single top level directory are flattened. Set stripComponents
+and archiveSubPath of the service to choose the extracted directory explicitly.
+
+Examples:
+	setup install
+	setup install --yes
+	setup install kafka@kafka-2.13-2.5.0 cassandra dynamodb
+	setup install kafka --offline --archive ./kafka_2.13-2.5.0.tgz
+	setup install --yes --parallel 3
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
@@ -60,59 +93,146 @@ Currently supports various versions of Kafka, Cassandra and DynamoDb.
 			return err
 		}
 
-		acceptDefaultAndInstall, defaultPromptErr := acceptDefaultAndInstallAllPrompt(&applicationConfiguration)
-		if defaultPromptErr != nil {
-			return defaultPromptErr
-		}
-
 		var servicesToInstall []string
 
-		if acceptDefaultAndInstall {
+		if len(args) > 0 {
+			servicesToInstall, err = servicesToInstallFromArgs(&applicationConfiguration, args)
+			if err != nil {
+				return err
+			}
+		} else if acceptDefaults {
 			servicesToInstall = defaultServicesToInstall(&applicationConfiguration)
 		} else {
-			servicesToInstall, err = chooseServicesToInstall(&applicationConfiguration)
+			servicesToInstall, err = promptServicesToInstall(&applicationConfiguration)
 			if err != nil {
 				return err
 			}
 		}
 
-		for _, selectedSvc := range servicesToInstall {
-			err := downloadAndExtract(&applicationConfiguration, selectedSvc)
-			if err != nil {
-				fmt.Println("Error installing service", selectedSvc, "Error: ", err.Error())
-			}
+		if parallelInstalls < 1 {
+			return errors.New("--parallel must be at least 1")
 		}
 
-		configurationString, err := marshalConfiguration(&applicationConfiguration)
+		err = configureExtractLimits()
 		if err != nil {
 			return err
 		}
-		viper.Set(ConfigurationKey, configurationString)
-		err = viper.WriteConfig()
+
+		archivePaths, err := parseArchiveFlags(archiveFlags, servicesToInstall)
 		if err != nil {
-			return errors.New("Error Writing Config File. Error: " + err.Error())
+			return err
 		}
 
+		err = checkValidServices(servicesToInstall)
+		if err != nil {
+			return err
+		}
+
+		err = checkInstallationPaths(&applicationConfiguration, servicesToInstall)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		if isOffline() {
+			err = checkOfflineArchives(ctx, &applicationConfiguration, servicesToInstall, archivePaths)
+			if err != nil {
+				return err
+			}
+		}
+
+		installedServices, failedServices := installServices(ctx, &applicationConfiguration, servicesToInstall, archivePaths)
+
+		// Services which finished installing before an interruption are still saved, so the
+		// configuration is updated without the command context
+		if len(installedServices) > 0 {
+			err = updateApplicationConfiguration(context.Background(), func(latestConfiguration *Configuration) error {
+				for _, service := range installedServices {
+					updateConfigAfterInstallation(service, latestConfiguration)
+
+					if linkErr := updateCurrentLink(latestConfiguration.Services[service.Name]); linkErr != nil {
+						fmt.Println("Error Linking Active Version for Service", service.Name, "Error is: ", linkErr.Error())
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return errors.New("Installation interrupted")
+		}
+		if len(failedServices) > 0 {
+			return fmt.Errorf("failed to install: %s", strings.Join(failedServices, ", "))
+		}
 		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(installCmd)
+
+	installCmd.Flags().BoolVarP(&acceptDefaults, "yes", "y", false, "accept defaults and install all enabled services without prompting")
+	installCmd.Flags().IntVarP(&parallelInstalls, "parallel", "p", 1, "number of services to download and install at the same time")
+	installCmd.Flags().StringArrayVar(&archiveFlags, "archive", nil, "install from a local archive instead of downloading it, given as path when installing a single service or as service=path")
 }
 
-// Read Configuration from $HOME/.setup.yml and marshall & set into applicationConfiguration
+// Read Configuration from the config file and marshall & set into applicationConfiguration
 func initializeApplicationConfiguration() (Configuration, error) {
-	configurationString := viper.GetString(ConfigurationKey)
-	applicationConfiguration := Configuration{}
-	if configurationString == "" {
-		return applicationConfiguration, errors.New("configuration initialization failed")
+	return loadApplicationConfiguration(viper.ConfigFileUsed())
+}
+
+func promptServicesToInstall(applicationConfiguration *Configuration) ([]string, error) {
+
+	err := ensureInteractive()
+	if err != nil {
+		return nil, err
 	}
-	err := unMarshalConfiguration(configurationString, &applicationConfiguration)
+
+	acceptDefaultAndInstall, err := acceptDefaultAndInstallAllPrompt(applicationConfiguration)
 	if err != nil {
-		return applicationConfiguration, err
+		return nil, err
+	}
+
+	if acceptDefaultAndInstall {
+		return defaultServicesToInstall(applicationConfiguration), nil
+	}
+	return chooseServicesToInstall(applicationConfiguration)
+}
+
+// Resolve service[@version] args to the services to install and set their SelectedVersion.
+// The configured default version is used when an arg doesn't specify a version
+func servicesToInstallFromArgs(applicationConfiguration *Configuration, args []string) ([]string, error) {
+
+	servicesToInstall := make([]string, 0, len(args))
+	for _, arg := range args {
+		serviceName, version := parseServiceArg(arg)
+
+		if serviceName == AllKey {
+			servicesToInstall = append(servicesToInstall, defaultServicesToInstall(applicationConfiguration)...)
+			continue
+		}
+
+		service, exists := applicationConfiguration.Services[serviceName]
+		if !exists {
+			return nil, errors.New("Unknown service: " + serviceName)
+		}
+		if !service.IsEnabled {
+			return nil, errors.New("Service " + serviceName + " is disabled in the configuration")
+		}
+
+		if version != "" {
+			if _, exists := service.Versions[version]; !exists {
+				return nil, fmt.Errorf("Unknown version %s of service %s. Available versions are: %s", version, serviceName, sortedVersionKeys(service.Versions))
+			}
+			service.SelectedVersion = version
+			applicationConfiguration.Services[serviceName] = service
+		}
+
+		servicesToInstall = append(servicesToInstall, serviceName)
 	}
-	return applicationConfiguration, nil
+	return servicesToInstall, nil
 }
 
 func acceptDefaultAndInstallAllPrompt(applicationConfiguration *Configuration) (bool, error) {
@@ -205,7 +325,7 @@ func selectAndSetServiceVersion(applicationConfiguration *Configuration, selecte
 		versionList := getVersionList(&selectedService.Versions)
 		selectVersionPrompt := &survey.Select{
 			Message:  fmt.Sprintf("Select %s version to install", selectedService.Name),
-			Help:     fmt.Sprintf("[%s] versions available for: %s", len(versionList), selectedService.Name),
+			Help:     fmt.Sprintf("[%d] versions available for: %s", len(versionList), selectedService.Name),
 			Options:  versionList,
 			PageSize: 10,
 		}
@@ -237,58 +357,538 @@ func addUnderScore(key string) string {
 	return strings.ReplaceAll(key, " ", "_")
 }
 
-func downloadAndExtract(applicationConfiguration *Configuration, selectedService string) error {
+// Override the default extraction limits with extractMaxSize (e.g. 8GB) and extractMaxEntries from the config file or environment
+func configureExtractLimits() error {
 
-	service := applicationConfiguration.Services[selectedService]
+	if maxSize := viper.GetString(ExtractMaxSizeKey); maxSize != "" {
+		size, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			return errors.New("Invalid " + ExtractMaxSizeKey + " " + maxSize + ". Error: " + err.Error())
+		}
+		util.DefaultExtractLimits.MaxSize = int64(size)
+	}
 
-	var url = service.UrlTemplate
+	if maxEntries := viper.GetInt(ExtractMaxEntriesKey); maxEntries > 0 {
+		util.DefaultExtractLimits.MaxEntries = maxEntries
+	}
+	return nil
+}
 
-	if strings.Contains(url, "{{") {
-		t, err := template.New("UrlTemplate").Parse(url)
-		if err != nil {
-			fmt.Println("Error Parsing UrlTemplate for Service", service.Name, "Please correct the url configuration")
-			return err
+// Map local archives given as --archive path or --archive service=path to the service they are installed for
+func parseArchiveFlags(archives []string, servicesToInstall []string) (map[string]string, error) {
+
+	archivePaths := make(map[string]string)
+	for _, archive := range archives {
+		serviceName, archivePath, found := strings.Cut(archive, "=")
+		if !found {
+			if len(servicesToInstall) != 1 {
+				return nil, errors.New("--archive " + archive + " is ambiguous when installing multiple services. Use --archive service=path instead")
+			}
+			serviceName, archivePath = servicesToInstall[0], archive
 		}
 
-		var result bytes.Buffer
+		if installing, _ := util.HasElement(servicesToInstall, serviceName); !installing {
+			return nil, errors.New("--archive " + archive + " is given for service " + serviceName + " which isn't being installed")
+		}
+		if !util.FileExists(archivePath) {
+			return nil, errors.New("--archive " + archivePath + " doesn't exist")
+		}
+		archivePaths[serviceName] = archivePath
+	}
+	return archivePaths, nil
+}
 
-		err = t.Execute(&result, service.Versions[service.SelectedVersion])
+// Check the installation path of every service to install is writable, before downloading anything
+func checkInstallationPaths(applicationConfiguration *Configuration, servicesToInstall []string) error {
+	for _, selectedSvc := range servicesToInstall {
+		service := applicationConfiguration.Services[selectedSvc]
+		if err := util.CheckWritableDir(service.InstallationPath); err != nil {
+			return errors.New("Can't install " + selectedSvc + " into " + service.InstallationPath + ". Error: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Check all services to install are available offline, from a local archive or the download cache.
+// Returns an error listing every archive which would need downloading otherwise
+func checkOfflineArchives(ctx context.Context, applicationConfiguration *Configuration, servicesToInstall []string, archivePaths map[string]string) error {
+
+	cacheDir, err := util.DefaultCacheDir()
+	if err != nil {
+		return errors.New("Error Resolving Download Cache Directory. Error: " + err.Error())
+	}
+
+	var missing []string
+	for _, selectedSvc := range servicesToInstall {
+		if archivePaths[selectedSvc] != "" {
+			continue
+		}
+
+		service := applicationConfiguration.Services[selectedSvc]
+		urls, err := resolveServiceUrls(service)
 		if err != nil {
-			fmt.Println("Error Parsing UrlTemplate for Service", service.Name, "Please correct the url configuration")
 			return err
 		}
+		checksum, err := resolveChecksum(ctx, service, urls)
+		if err != nil {
+			return err
+		}
+
+		if _, cached := util.CachedFile(cacheDir, urls, checksum); !cached {
+			missing = append(missing, fmt.Sprintf("\t%s@%s from %s", selectedSvc, service.SelectedVersion, urls[0]))
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.New("Offline mode: the following archives aren't in the download cache and would need downloading:\n" +
+			strings.Join(missing, "\n") +
+			"\nInstall them once while online, or pass local archives with --archive service=path")
+	}
+	return nil
+}
+
+// Install services with a pool of parallelInstalls workers, showing the progress of each service on its own line.
+// Returns the services which were installed, with their installed version as SelectedVersion, and the
+// sorted names of the services which failed to install
+func installServices(ctx context.Context, applicationConfiguration *Configuration, servicesToInstall []string, archivePaths map[string]string) ([]Service, []string) {
+
+	progress := util.NewProgress()
+	defer progress.Stop()
+
+	bars := make(map[string]*util.ProgressBar)
+	queue := make(chan string)
+	for _, selectedSvc := range servicesToInstall {
+		if bars[selectedSvc] == nil {
+			bars[selectedSvc] = progress.Bar(selectedSvc, "waiting")
+		}
+	}
+
+	var installedServices []Service
+	var failedServices []string
+	var installedMutex sync.Mutex
+
+	var workers sync.WaitGroup
+	for i := 0; i < parallelInstalls && i < len(bars); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for selectedSvc := range queue {
+				err := downloadAndExtract(ctx, applicationConfiguration, selectedSvc, archivePaths[selectedSvc], bars[selectedSvc])
+				if err != nil && ctx.Err() != nil {
+					bars[selectedSvc].SetStatus("cancelled")
+				} else if err != nil {
+					util.Println("Error installing service", selectedSvc, "Error: ", err.Error())
+					bars[selectedSvc].SetStatus("failed")
+					installedMutex.Lock()
+					failedServices = append(failedServices, selectedSvc)
+					installedMutex.Unlock()
+				} else {
+					installedMutex.Lock()
+					installedServices = append(installedServices, applicationConfiguration.Services[selectedSvc])
+					installedMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	queued := make(map[string]bool)
+	for _, selectedSvc := range servicesToInstall {
+		if queued[selectedSvc] {
+			continue
+		}
+		queued[selectedSvc] = true
+
+		select {
+		case queue <- selectedSvc:
+		case <-ctx.Done():
+			bars[selectedSvc].SetStatus("cancelled")
+		}
+	}
+	close(queue)
+	workers.Wait()
+
+	sort.Strings(failedServices)
+	return installedServices, failedServices
+}
+
+func downloadAndExtract(ctx context.Context, applicationConfiguration *Configuration, selectedService string, archivePath string, bar *util.ProgressBar) error {
 
-		url = result.String()
+	service := applicationConfiguration.Services[selectedService]
+
+	bar.SetStatus("resolving " + service.SelectedVersion)
+
+	urls, err := resolveServiceUrls(service)
+	if err != nil {
+		util.Println("Error Parsing UrlTemplate for Service", service.Name, "Please correct the url configuration")
+		return err
+	}
+
+	checksum, err := resolveChecksum(ctx, service, urls)
+	if err != nil {
+		util.Println("Error Resolving Checksum for Service", service.Name, "Please correct the checksum configuration")
+		return err
 	}
 
 	folderErr := os.MkdirAll(service.InstallationPath, 0755)
 	if folderErr != nil {
-		fmt.Println("Error Creating Installation Directory. Please select proper installation path", "Error is: ", folderErr.Error())
+		util.Println("Error Creating Installation Directory. Please select proper installation path", "Error is: ", folderErr.Error())
 		return folderErr
 	}
 
-	downloadedFilePath, err := util.DownloadFile(service.InstallationPath, url)
+	// Another setup process may be installing or uninstalling the same version
+	versionLock, err := lockServiceVersion(ctx, service, service.SelectedVersion)
+	if err != nil {
+		return err
+	}
+	defer versionLock.Unlock()
+
+	downloadedFilePath, err := fetchArchive(ctx, service, urls, checksum, archivePath, bar)
 	if err != nil {
-		fmt.Println("Error Downloading Service", service.Name, "Error is: ", err.Error())
 		return err
 	}
 
-	extractErr := util.ExtractTarGz(downloadedFilePath, filepath.FromSlash(service.InstallationPath+"/"+service.SelectedVersion))
-	_ = os.Remove(downloadedFilePath)
-	if extractErr != nil {
-		return extractErr
+	bar.SetStatus("extracting " + filepath.Base(downloadedFilePath))
+
+	// Install into a staging directory first, and only move it into place once complete, so
+	// a failed or interrupted installation never leaves a half populated version directory
+	stagingDir, err := util.NewStagingDir(service.InstallationPath, service.SelectedVersion)
+	if err != nil {
+		util.Println("Error Creating Staging Directory for Service", service.Name, "Error is: ", err.Error())
+		return err
+	}
+	defer util.RemoveStagingDir(stagingDir)
+
+	stagedVersionDir := filepath.Join(stagingDir, service.SelectedVersion)
+	switch service.Type {
+	case "", ArchiveServiceType:
+		err = util.Extract(ctx, downloadedFilePath, stagedVersionDir, extractLayout(service))
+	case BinaryServiceType:
+		err = util.InstallBinary(ctx, downloadedFilePath, filepath.Join(stagedVersionDir, "bin"), binaryName(service))
+	default:
+		err = errors.New("unknown type " + service.Type + " of service " + service.Name + ". Supported types are " + ArchiveServiceType + " and " + BinaryServiceType)
+	}
+	if err != nil {
+		return err
 	}
 
-	updateConfigAfterInstallation(service, applicationConfiguration)
+	versionDir := filepath.FromSlash(service.InstallationPath + "/" + service.SelectedVersion)
+	if err = util.ReplaceDir(stagedVersionDir, versionDir); err != nil {
+		util.Println("Error Moving Installation into", versionDir, "Error is: ", err.Error())
+		return err
+	}
+	bar.SetStatus("installed " + service.SelectedVersion + " at " + versionDir)
 
 	return nil
 }
 
-func updateConfigAfterInstallation(service Service, applicationConfiguration *Configuration) {
+// Layout of the archive configured for the service. Without stripComponents and archiveSubPath
+// a single top level directory is flattened, otherwise the configured layout is used as is
+func extractLayout(service Service) util.ExtractLayout {
+	layout := util.DefaultExtractLayout
+	if service.StripComponents != nil || service.ArchiveSubPath != "" {
+		layout = util.ExtractLayout{SubPath: service.ArchiveSubPath}
+		if service.StripComponents != nil {
+			layout.StripComponents = *service.StripComponents
+		}
+	}
+	return layout
+}
+
+// Lock InstallationPath/<version> of service against other setup processes. The lock file is kept
+// under $HOME/.setup/locks, keyed by the version directory, so it isn't left behind in InstallationPath
+func lockServiceVersion(ctx context.Context, service Service, version string) (*flock.Flock, error) {
+	setupHome, err := setupHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	versionDir, err := filepath.Abs(filepath.Join(service.InstallationPath, version))
+	if err != nil {
+		return nil, err
+	}
+	versionDirHash := sha256.Sum256([]byte(versionDir))
+	lockPath := filepath.FromSlash(setupHome + "/locks/" + service.Name + "-" + hex.EncodeToString(versionDirHash[:6]) + ".lock")
+	lock, err := util.LockFile(ctx, lockPath, "using "+service.Name+"@"+version)
+	if err != nil {
+		return nil, errors.New("Error Locking " + service.Name + "@" + version + ". Error: " + err.Error())
+	}
+	return lock, nil
+}
+
+// Name of the executable of a binary service, which defaults to the service name
+func binaryName(service Service) string {
+	if service.BinaryName != "" {
+		return service.BinaryName
+	}
+	return service.Name
+}
+
+// Return the archive of the selected version, either the given local archivePath, from the download
+// cache, or downloaded from the first working url. Downloads are verified and then added to the cache,
+// so cached archives don't need to be verified against their signature again
+func fetchArchive(ctx context.Context, service Service, urls []string, checksum *util.Checksum, archivePath string, bar *util.ProgressBar) (string, error) {
+
+	if archivePath != "" {
+		bar.SetStatus("verifying " + filepath.Base(archivePath))
+		return archivePath, verifyLocalArchive(ctx, service, urls, checksum, archivePath)
+	}
+
+	cacheDir, err := util.DefaultCacheDir()
+	if err != nil {
+		return "", errors.New("Error Resolving Download Cache Directory. Error: " + err.Error())
+	}
+
+	if cachedFilePath, cached := util.CachedFile(cacheDir, urls, checksum); cached {
+		util.Println("Using cached download", cachedFilePath)
+		return cachedFilePath, nil
+	}
+
+	if isOffline() {
+		return "", errors.New("Offline mode: " + service.Name + "@" + service.SelectedVersion + " isn't in the download cache and would need downloading from " + urls[0])
+	}
+
+	partialDownloadDir := filepath.Join(cacheDir, util.PartialDownloadDir)
+	err = os.MkdirAll(partialDownloadDir, 0755)
+	if err != nil {
+		return "", errors.New("Error Creating Download Cache Directory. Error: " + err.Error())
+	}
+
+	downloadedFilePath, url, err := util.DownloadFromMirrors(ctx, partialDownloadDir, urls, checksum, bar)
+	if err != nil {
+		if ctx.Err() == nil {
+			util.Println("Error Downloading Service", service.Name, "Error is: ", err.Error())
+		}
+		return "", err
+	}
+
+	bar.SetStatus("verifying " + util.DownloadFileName(url))
+	err = verifySignature(ctx, service, url, downloadedFilePath)
+	if err != nil {
+		_ = os.Remove(downloadedFilePath)
+		util.Println("Error Verifying Signature of Service", service.Name, "Error is: ", err.Error())
+		return "", err
+	}
+
+	return util.AddToCache(cacheDir, downloadedFilePath, url, checksum)
+}
+
+// Verify a local archive against the checksum, and the signature when online
+func verifyLocalArchive(ctx context.Context, service Service, urls []string, checksum *util.Checksum, archivePath string) error {
+
+	if checksum != nil {
+		err := util.VerifyFileChecksum(archivePath, checksum)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isOffline() {
+		if service.SignatureUrlTemplate != "" {
+			util.Println("Offline mode: skipping signature verification of", archivePath)
+		}
+		return nil
+	}
+
+	return verifySignature(ctx, service, urls[0], archivePath)
+}
+
+// Execute text as a template against versionMap. Text without any template action is returned as is
+func renderTemplate(name string, text string, versionMap VersionMap) (string, error) {
+
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var result bytes.Buffer
+
+	err = t.Execute(&result, versionMap)
+	if err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// Render UrlTemplate followed by MirrorUrlTemplates for the selected version, in the order they should be tried
+func resolveServiceUrls(service Service) ([]string, error) {
+
+	urlTemplates := append([]string{service.UrlTemplate}, service.MirrorUrlTemplates...)
+	urls := make([]string, 0, len(urlTemplates))
+	for _, urlTemplate := range urlTemplates {
+		url, err := renderTemplate("UrlTemplate", urlTemplate, service.Versions[service.SelectedVersion])
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// Resolve the expected checksum of the selected version, either from a literal Checksum in the
+// version or by fetching ChecksumUrlTemplate. Returns nil when no checksum is configured
+func resolveChecksum(ctx context.Context, service Service, urls []string) (*util.Checksum, error) {
+
+	versionMap := service.Versions[service.SelectedVersion]
+
+	if literalChecksum := versionMap[ChecksumKey]; literalChecksum != "" {
+		return util.ParseChecksum(literalChecksum)
+	}
+
+	// Published checksums can't be fetched offline, cached archives are then looked up by url instead
+	if service.ChecksumUrlTemplate == "" || isOffline() {
+		return nil, nil
+	}
+
+	content, err := fetchForUrls(ctx, "ChecksumUrlTemplate", service.ChecksumUrlTemplate, versionMap, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.ParseChecksum(string(content))
+}
+
+// Fetch the file which templateText derives from the download url, trying each of the
+// mirror urls in turn. Urls rendering to the same file are only fetched once
+func fetchForUrls(ctx context.Context, name string, templateText string, versionMap VersionMap, urls []string) ([]byte, error) {
+
+	var lastErr error
+	fetchedUrls := make(map[string]bool)
+	for _, url := range urls {
+		fileUrl, err := renderTemplate(name, templateText, withUrl(versionMap, url))
+		if err != nil {
+			return nil, err
+		}
+		if fetchedUrls[fileUrl] {
+			continue
+		}
+		fetchedUrls[fileUrl] = true
+
+		content, err := util.FetchContent(ctx, fileUrl)
+		if err == nil {
+			return content, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Verify the detached signature of the downloaded archive against the service keys.
+// Skipped when no SignatureUrlTemplate is configured
+func verifySignature(ctx context.Context, service Service, url string, downloadedFilePath string) error {
+
+	if service.SignatureUrlTemplate == "" {
+		return nil
+	}
+
+	signatureUrl, err := renderTemplate("SignatureUrlTemplate", service.SignatureUrlTemplate, withUrl(service.Versions[service.SelectedVersion], url))
+	if err != nil {
+		return err
+	}
+
+	signature, err := util.FetchContent(ctx, signatureUrl)
+	if err != nil {
+		return err
+	}
+
+	keysFile, cached, err := resolveKeysFile(ctx, service, false)
+	if err != nil {
+		return err
+	}
+
+	err = verifySignatureWithKeys(downloadedFilePath, signature, keysFile)
+	if err == nil || !cached {
+		return err
+	}
+
+	// The project may have released with a new key since the KEYS were cached
+	util.Println("Signature verification failed with cached KEYS of", service.Name, "fetching them again from", service.KeysUrl)
+	keysFile, _, err = resolveKeysFile(ctx, service, true)
+	if err != nil {
+		return err
+	}
+	return verifySignatureWithKeys(downloadedFilePath, signature, keysFile)
+}
+
+func verifySignatureWithKeys(downloadedFilePath string, signature []byte, keysFile string) error {
+	keyRing, err := util.ReadKeyRing(keysFile)
+	if err != nil {
+		return err
+	}
+	return util.VerifySignature(downloadedFilePath, signature, keyRing)
+}
+
+// Return the KeysFile of the service, or the KEYS file downloaded from KeysUrl. Downloaded
+// KEYS are cached under $HOME/.setup/keys so repeated installs don't need to fetch them again,
+// unless refresh is set. cached reports if the returned KEYS were downloaded by an earlier install
+func resolveKeysFile(ctx context.Context, service Service, refresh bool) (keysFile string, cached bool, err error) {
+
+	if service.KeysFile != "" {
+		return service.KeysFile, false, nil
+	}
+
+	if service.KeysUrl == "" {
+		return "", false, errors.New("signatureUrlTemplate is configured without keysUrl or keysFile for service " + service.Name)
+	}
+
+	setupHome, err := setupHomeDir()
+	if err != nil {
+		return "", false, err
+	}
+
+	urlHash := sha256.Sum256([]byte(service.KeysUrl))
+	keysFile = filepath.FromSlash(setupHome + "/keys/" + service.Name + "-" + hex.EncodeToString(urlHash[:6]) + ".KEYS")
+	if !refresh && util.FileExists(keysFile) {
+		return keysFile, true, nil
+	}
+
+	keys, err := util.FetchContent(ctx, service.KeysUrl)
+	if err != nil {
+		return "", false, errors.New("Error Downloading KEYS from " + service.KeysUrl + ". Error: " + err.Error())
+	}
+
+	err = os.MkdirAll(filepath.Dir(keysFile), 0755)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Written atomically, as other setup processes may be reading the cached KEYS
+	err = util.WriteFileAtomic(keysFile, keys, 0644)
+	if err != nil {
+		return "", false, err
+	}
+
+	return keysFile, false, nil
+}
+
+// Copy versionMap with the resolved download url added as Url, for templates which derive from the download url
+func withUrl(versionMap VersionMap, url string) VersionMap {
+	templateData := make(VersionMap, len(versionMap)+1)
+	for key, val := range versionMap {
+		templateData[key] = val
+	}
+	templateData[UrlKey] = url
+	return templateData
+}
+
+// Record the installed version of service in applicationConfiguration
+func updateConfigAfterInstallation(installedService Service, applicationConfiguration *Configuration) {
+	service, exists := applicationConfiguration.Services[installedService.Name]
+	if !exists {
+		service = installedService
+	}
+	service.SelectedVersion = installedService.SelectedVersion
+
 	if service.ActiveVersion == "" {
 		service.ActiveVersion = service.SelectedVersion
 	}
 
-	service.InstalledVersion = append(service.InstalledVersion, service.SelectedVersion)
+	if installed, _ := util.HasElement(service.InstalledVersion, service.SelectedVersion); !installed {
+		service.InstalledVersion = append(service.InstalledVersion, service.SelectedVersion)
+	}
 	applicationConfiguration.Services[service.Name] = service
 }
@@ -0,0 +1,163 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	TableOutput string = "table"
+	JsonOutput  string = "json"
+	YamlOutput  string = "yaml"
+)
+
+var listOutput string
+
+type ServiceSummary struct {
+	Name              string   `json:"name" yaml:"name"`
+	IsEnabled         bool     `json:"enabled" yaml:"enabled"`
+	SelectedVersion   string   `json:"defaultVersion" yaml:"defaultVersion"`
+	ActiveVersion     string   `json:"activeVersion" yaml:"activeVersion"`
+	InstalledVersion  []string `json:"installedVersion" yaml:"installedVersion"`
+	AvailableVersions []string `json:"availableVersions" yaml:"availableVersions"`
+}
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list [service]...",
+	Short: "list available, installed and active versions of services",
+	Long: `list available, installed and active versions of all or selected services.
+
+Examples:
+	setup list
+	setup list kafka
+	setup list kafka cassandra --output json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		applicationConfiguration, err := initializeApplicationConfiguration()
+		if err != nil {
+			return err
+		}
+
+		serviceSummaries, err := summarizeServices(&applicationConfiguration, args)
+		if err != nil {
+			return err
+		}
+
+		switch listOutput {
+		case TableOutput:
+			return printServiceSummaryTable(serviceSummaries)
+		case JsonOutput:
+			marshal, err := json.MarshalIndent(serviceSummaries, "", "  ")
+			if err != nil {
+				return errors.New("Error Marshalling Service List. Error: " + err.Error())
+			}
+			fmt.Println(string(marshal))
+		case YamlOutput:
+			marshal, err := yaml.Marshal(serviceSummaries)
+			if err != nil {
+				return errors.New("Error Marshalling Service List. Error: " + err.Error())
+			}
+			fmt.Print(string(marshal))
+		default:
+			return errors.New("Unknown output format: " + listOutput + ". Use one of table, json or yaml")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", TableOutput, "output format: table, json or yaml")
+}
+
+// Build a summary of each requested service, or of all services when serviceNames is empty, sorted by service name
+func summarizeServices(applicationConfiguration *Configuration, serviceNames []string) ([]ServiceSummary, error) {
+
+	if len(serviceNames) == 0 {
+		for key := range applicationConfiguration.Services {
+			serviceNames = append(serviceNames, key)
+		}
+		sort.Strings(serviceNames)
+	}
+
+	serviceSummaries := make([]ServiceSummary, 0, len(serviceNames))
+	for _, serviceName := range serviceNames {
+		service, exists := applicationConfiguration.Services[serviceName]
+		if !exists {
+			return nil, errors.New("Unknown service: " + serviceName)
+		}
+
+		installedVersion := service.InstalledVersion
+		if installedVersion == nil {
+			installedVersion = []string{}
+		}
+
+		serviceSummaries = append(serviceSummaries, ServiceSummary{
+			Name:              serviceName,
+			IsEnabled:         service.IsEnabled,
+			SelectedVersion:   service.SelectedVersion,
+			ActiveVersion:     service.ActiveVersion,
+			InstalledVersion:  installedVersion,
+			AvailableVersions: sortedVersionKeys(service.Versions),
+		})
+	}
+	return serviceSummaries, nil
+}
+
+func printServiceSummaryTable(serviceSummaries []ServiceSummary) error {
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "SERVICE\tENABLED\tDEFAULT\tACTIVE\tINSTALLED\tAVAILABLE")
+	for _, summary := range serviceSummaries {
+		_, _ = fmt.Fprintf(writer, "%s\t%t\t%s\t%s\t%s\t%s\n",
+			summary.Name,
+			summary.IsEnabled,
+			valueOrDash(summary.SelectedVersion),
+			valueOrDash(summary.ActiveVersion),
+			valueOrDash(strings.Join(summary.InstalledVersion, ", ")),
+			valueOrDash(strings.Join(summary.AvailableVersions, ", ")))
+	}
+	return writer.Flush()
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -26,23 +26,59 @@ package cmd
 
 import (
 	"com.github/RawSanj/setup/util"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/gofrs/flock"
+	"github.com/mattn/go-isatty"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 )
 
 var cfgFile string
+var offline bool
+
+// Directory under the user HOME where setup keeps its own state, like cached signing keys
+const SetupHomeDirName = ".setup"
+
+const (
+	// Env var with the path of the config file, like the --config flag
+	ConfigEnv string = "SETUP_CONFIG"
+	// Name of the config file in $XDG_CONFIG_HOME/setup
+	XdgConfigFileName string = "config.yml"
+	// Config file in the user HOME used by earlier versions
+	LegacyConfigFileName string = ".setup.yml"
+)
 
 const (
 	Kafka            string = "kafka"
 	Cassandra        string = "cassandra"
 	DynamoDb         string = "dynamodb"
 	ConfigurationKey string = "configuration"
+	ConfigVersionKey string = "version"
+	OfflineKey       string = "offline"
+	// Optional top level config keys overriding the limits of archive extraction
+	ExtractMaxSizeKey    string = "extractMaxSize"
+	ExtractMaxEntriesKey string = "extractMaxEntries"
+	ChecksumKey          string = "Checksum"
+	UrlKey               string = "Url"
+)
+
+// Service types. Archives are extracted into the version directory, binaries are
+// placed at bin/<binaryName> of the version directory
+const (
+	ArchiveServiceType string = "archive"
+	BinaryServiceType  string = "binary"
 )
 
 type Configuration struct {
@@ -53,14 +89,23 @@ type Configuration struct {
 type VersionMap map[string]string
 
 type Service struct {
-	Name             string                `yaml:"name"`
-	UrlTemplate      string                `yaml:"urlTemplate"`
-	InstallationPath string                `yaml:"path"`
-	IsEnabled        bool                  `yaml:"enabled"`
-	Versions         map[string]VersionMap `yaml:"availableVersions"`
-	SelectedVersion  string                `yaml:"defaultVersion"`
-	ActiveVersion    string                `yaml:"activeVersion"`
-	InstalledVersion []string              `yaml:"installedVersion"`
+	Name                 string                `yaml:"name"`
+	Type                 string                `yaml:"type,omitempty"`
+	BinaryName           string                `yaml:"binaryName,omitempty"`
+	StripComponents      *int                  `yaml:"stripComponents,omitempty"`
+	ArchiveSubPath       string                `yaml:"archiveSubPath,omitempty"`
+	UrlTemplate          string                `yaml:"urlTemplate"`
+	MirrorUrlTemplates   []string              `yaml:"mirrorUrlTemplates,omitempty"`
+	ChecksumUrlTemplate  string                `yaml:"checksumUrlTemplate,omitempty"`
+	SignatureUrlTemplate string                `yaml:"signatureUrlTemplate,omitempty"`
+	KeysUrl              string                `yaml:"keysUrl,omitempty"`
+	KeysFile             string                `yaml:"keysFile,omitempty"`
+	InstallationPath     string                `yaml:"path"`
+	IsEnabled            bool                  `yaml:"enabled"`
+	Versions             map[string]VersionMap `yaml:"availableVersions"`
+	SelectedVersion      string                `yaml:"defaultVersion"`
+	ActiveVersion        string                `yaml:"activeVersion"`
+	InstalledVersion     []string              `yaml:"installedVersion"`
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -75,12 +120,32 @@ Currently it supports the following services:
 	2. Zookeeper
 	3. Cassandra
 	4. DynamoDb
+Other services can be added with setup service add.
 
 Author: Sanjay Rawat - https://rawsanj.dev`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
+	// Errors are printed once by Execute
+	SilenceErrors: true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return initializeConfigFile()
+		// Args and flags are parsed by now, the errors from here on aren't usage errors
+		cmd.SilenceUsage = true
+
+		// The download cache is independent of the config file
+		if isCacheCommand(cmd) {
+			return nil
+		}
+
+		err := initializeConfigFile(cmd.Context())
+		if err == nil {
+			// The config commands handle outdated and invalid config files themselves, e.g. to fix them
+			if cmd.HasParent() && cmd.Parent() == configCmd {
+				err = checkConfigVersion()
+			} else if err = migrateConfigFile(cmd.Context()); err == nil {
+				err = warnInvalidConfigFile()
+			}
+		}
+		return err
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
@@ -89,8 +154,18 @@ Author: Sanjay Rawat - https://rawsanj.dev`,
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The context of every command is cancelled on Ctrl-C or SIGTERM, so running downloads and
+// extractions stop and clean up. A second Ctrl-C kills the process right away
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -103,7 +178,8 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.setup.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (env SETUP_CONFIG, default is $XDG_CONFIG_HOME/setup/config.yml, or $HOME/.setup.yml when it exists)")
+	rootCmd.PersistentFlags().BoolVar(&offline, OfflineKey, false, "install only from the download cache or local archives, never download (env SETUP_OFFLINE)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -112,32 +188,65 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
+	configFile, err := resolveConfigFile()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-		// Search config in home directory with name ".setup" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".setup")
+	// The same file is read, created and written by all commands
+	viper.SetConfigFile(configFile)
+	if filepath.Ext(configFile) == "" {
 		viper.SetConfigType("yml")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	viper.SetEnvPrefix("setup")
+	viper.AutomaticEnv() // read in environment variables that match, e.g. SETUP_OFFLINE
 
 	// If a config file is found, read it in.
 	_ = viper.ReadInConfig()
 }
 
+// Resolve the config file from the --config flag, the SETUP_CONFIG env var, or the default
+// location. The default is $XDG_CONFIG_HOME/setup/config.yml, but an existing $HOME/.setup.yml
+// created by earlier versions keeps being used
+func resolveConfigFile() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	if configFile := os.Getenv(ConfigEnv); configFile != "" {
+		return configFile, nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.New("Error getting User HOME directory. Please set the HOME environment pointing to your Home directory. Error is: " + err.Error())
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	xdgConfigFile := filepath.Join(configHome, "setup", XdgConfigFileName)
+	if util.FileExists(xdgConfigFile) {
+		return xdgConfigFile, nil
+	}
+
+	legacyConfigFile := filepath.Join(home, LegacyConfigFileName)
+	if util.FileExists(legacyConfigFile) {
+		return legacyConfigFile, nil
+	}
+	return xdgConfigFile, nil
+}
+
 // Initialize and create Service Configuration yaml file
-// Ignore file creation if $HOME/.setup.yml already exists
-func initializeConfigFile() error {
+// Ignore file creation if the resolved config file already exists
+func initializeConfigFile(ctx context.Context) error {
+
+	configFile := viper.ConfigFileUsed()
+	if util.FileExists(configFile) {
+		return nil
+	}
 
 	home, err := homedir.Dir()
 	if err != nil {
@@ -146,37 +255,241 @@ func initializeConfigFile() error {
 		return err
 	}
 
-	// Skip Config and File creation if file already exists
-	if util.FileExists(filepath.FromSlash(home + "/.setup.yml")) {
-		return nil
+	err = os.MkdirAll(filepath.Dir(configFile), 0755)
+	if err != nil {
+		return errors.New("Error Creating Config Directory. Error: " + err.Error())
+	}
+
+	lock, err := lockApplicationConfiguration(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Another setup process may have created it while waiting for the lock
+	if util.FileExists(configFile) {
+		return viper.ReadInConfig()
 	}
 
 	configuration := createApplicationConfig(home)
-	configurationString, err := marshalConfiguration(&configuration)
+	err = saveApplicationConfiguration(&configuration)
 	if err != nil {
 		return err
 	}
+	_ = viper.ReadInConfig()
+	// stderr, so the output of commands like list -o json stays parseable
+	fmt.Fprintln(os.Stderr, "Created configuration file", configFile)
+	return nil
+}
 
-	viper.Set("application", "setup is a cli tool written in Go to download and install development services.")
-	viper.Set("version", "1.0")
-	viper.Set(ConfigurationKey, configurationString)
-	viper.AddConfigPath(home)
-	viper.SetConfigName(".setup")
-	viper.SetConfigType("yml")
+// Read the config file as an ordered YAML document, so keys other than configuration are
+// written back as they are
+func readConfigDocument(configFile string) (yaml.MapSlice, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.MapSlice
+	err = yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, errors.New("Error Parsing Config File " + configFile + ". Error: " + err.Error())
+	}
+	return document, nil
+}
+
+// Return the value of key in document
+func documentValue(document yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range document {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Decode the configuration of the config file. It's read as YAML rather than through viper,
+// as viper lower cases all keys, which would change version names and the template fields
+// of versions. Config files of earlier versions store it as a YAML string, which is decoded too
+func loadApplicationConfiguration(configFile string) (Configuration, error) {
+	applicationConfiguration := Configuration{}
 
-	err = viper.SafeWriteConfig()
+	document, err := readConfigDocument(configFile)
+	if err != nil {
+		return applicationConfiguration, err
+	}
+
+	value, exists := documentValue(document, ConfigurationKey)
+	if !exists || value == nil {
+		return applicationConfiguration, errors.New("configuration initialization failed")
+	}
+
+	if configurationString, isString := value.(string); isString {
+		err = unMarshalConfiguration(configurationString, &applicationConfiguration)
+		return applicationConfiguration, err
+	}
+
+	configurationYaml, err := yaml.Marshal(value)
+	if err == nil {
+		err = yaml.Unmarshal(configurationYaml, &applicationConfiguration)
+	}
+	if err != nil {
+		return applicationConfiguration, errors.New("Error UnMarshalling Configuration. Error: " + err.Error())
+	}
+	return applicationConfiguration, nil
+}
+
+// Write applicationConfiguration to the config file, see configDocumentContent
+func saveApplicationConfiguration(applicationConfiguration *Configuration) error {
+	configFile := viper.ConfigFileUsed()
+
+	content, err := configDocumentContent(configFile, applicationConfiguration, "")
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file renamed over the config file, so other setup processes
+	// never read a partially written config
+	err = util.WriteFileAtomic(configFile, content, 0644)
 	if err != nil {
 		return errors.New("Error Writing Config File. Error: " + err.Error())
 	}
 	return nil
 }
 
-func marshalConfiguration(configuration *Configuration) (string, error) {
-	marshal, err := yaml.Marshal(&configuration)
+// Return the content of configFile with applicationConfiguration as nested YAML under the
+// configuration key, and version as the schema version unless it's empty. A new document
+// is started when configFile doesn't exist yet
+func configDocumentContent(configFile string, applicationConfiguration *Configuration, version string) ([]byte, error) {
+
+	document, err := readConfigDocument(configFile)
+	if os.IsNotExist(err) {
+		document = yaml.MapSlice{
+			{Key: "application", Value: "setup is a cli tool written in Go to download and install development services."},
+			{Key: ConfigVersionKey, Value: currentConfigVersion()},
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	document = setDocumentValue(document, ConfigurationKey, applicationConfiguration)
+	if version != "" {
+		document = setDocumentValue(document, ConfigVersionKey, version)
+	}
+
+	content, err := yaml.Marshal(document)
 	if err != nil {
-		return "", errors.New("Error Marshalling Configuration. Error: " + err.Error())
+		return nil, errors.New("Error Marshalling Configuration. Error: " + err.Error())
+	}
+	return content, nil
+}
+
+// Replace the value of key in document, or append it when document doesn't have key
+func setDocumentValue(document yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i := range document {
+		if document[i].Key == key {
+			document[i].Value = value
+			return document
+		}
+	}
+	return append(document, yaml.MapItem{Key: key, Value: value})
+}
+
+// Lock the config file against other setup processes reading, changing and writing it at the same time.
+// The lock file is kept under $HOME/.setup/locks, keyed by the config file, so it isn't left
+// behind next to the config file
+func lockApplicationConfiguration(ctx context.Context) (*flock.Flock, error) {
+	lockPath, err := configLockPath(viper.ConfigFileUsed())
+	if err != nil {
+		return nil, errors.New("Error Locking Config File. Error: " + err.Error())
+	}
+	lock, err := util.LockFile(ctx, lockPath, "to update "+viper.ConfigFileUsed())
+	if err != nil {
+		return nil, errors.New("Error Locking Config File. Error: " + err.Error())
+	}
+	return lock, nil
+}
+
+// Return the path of the lock file of configFile
+func configLockPath(configFile string) (string, error) {
+	setupHome, err := setupHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	configFile, err = filepath.Abs(configFile)
+	if err != nil {
+		return "", err
+	}
+	configFileHash := sha256.Sum256([]byte(configFile))
+	return filepath.FromSlash(setupHome + "/locks/config-" + hex.EncodeToString(configFileHash[:6]) + ".lock"), nil
+}
+
+// Apply update to the latest configuration and save it, while holding the config file lock.
+// The config file is read again after locking, so changes another setup process saved in
+// the meantime are kept
+func updateApplicationConfiguration(ctx context.Context, update func(*Configuration) error) error {
+	lock, err := lockApplicationConfiguration(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	applicationConfiguration, err := loadApplicationConfiguration(viper.ConfigFileUsed())
+	if err != nil {
+		return err
+	}
+
+	err = update(&applicationConfiguration)
+	if err != nil {
+		return err
+	}
+	return saveApplicationConfiguration(&applicationConfiguration)
+}
+
+// Split a service argument of the form service@version into its parts.
+// Version is empty when the argument doesn't contain one.
+func parseServiceArg(arg string) (string, string) {
+	serviceName, version, _ := strings.Cut(arg, "@")
+	return serviceName, addUnderScore(version)
+}
+
+// Whether downloads are disabled with --offline or SETUP_OFFLINE. The flag isn't bound to
+// viper, as viper would then persist it into the config file on the next write
+func isOffline() bool {
+	return offline || viper.GetBool(OfflineKey)
+}
+
+// Directory where setup keeps its own state, $HOME/.setup
+func setupHomeDir() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(home + "/" + SetupHomeDirName), nil
+}
+
+// Return the keys of versions in sorted order
+func sortedVersionKeys(versions map[string]VersionMap) []string {
+	versionKeys := make([]string, 0, len(versions))
+	for key := range versions {
+		versionKeys = append(versionKeys, key)
+	}
+	sort.Strings(versionKeys)
+	return versionKeys
+}
+
+// Check if stdin is a terminal survey prompts can be shown on
+func isInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// Fail fast when stdin is not a terminal, as survey prompts would otherwise hang or fail obscurely
+func ensureInteractive() error {
+	if isInteractive() {
+		return nil
 	}
-	return string(marshal), nil
+	return errors.New("stdin is not a terminal, unable to prompt for input. Pass the services as arguments, e.g. setup install kafka@kafka-2.13-2.5.0 cassandra, or use --yes to accept defaults")
 }
 
 func unMarshalConfiguration(configurationStr string, applicationConfiguration *Configuration) error {
@@ -212,34 +525,42 @@ func createApplicationConfig(home string) Configuration {
 		{"Name": "kafka-2.12-2.5.0", "Scala": "2.12", "Version": "2.5.0"}, {"Name": "kafka-2.13-2.5.0", "Scala": "2.13", "Version": "2.5.0"},
 	}
 	kafkaService := Service{
-		Name:             Kafka,
-		UrlTemplate:      "https://archive.apache.org/dist/kafka/{{.Version}}/kafka_{{.Scala}}-{{.Version}}.tgz",
-		Versions:         createVersionMap(&kafkaVersions),
-		SelectedVersion:  "kafka-2.13-2.5.0",
-		InstallationPath: filepath.FromSlash(home + "/.bin" + "/" + Kafka),
-		IsEnabled:        true,
+		Name:                 Kafka,
+		UrlTemplate:          "https://archive.apache.org/dist/kafka/{{.Version}}/kafka_{{.Scala}}-{{.Version}}.tgz",
+		ChecksumUrlTemplate:  "{{.Url}}.sha512",
+		SignatureUrlTemplate: "{{.Url}}.asc",
+		KeysUrl:              "https://downloads.apache.org/kafka/KEYS",
+		Versions:             createVersionMap(&kafkaVersions),
+		SelectedVersion:      "kafka-2.13-2.5.0",
+		InstallationPath:     filepath.FromSlash(home + "/.bin" + "/" + Kafka),
+		IsEnabled:            true,
 	}
 
 	cassandraVersions := []VersionMap{{"Name": "v2.1.21", "Version": "2.1.21"}, {"Name": "v2.2.17", "Version": "2.2.17"}, {"Name": "v3.0.20", "Version": "3.0.20"}, {"Name": "v3.11.7", "Version": "3.11.7"}, {"Name": "v4.0-beta1", "Version": "4.0-beta1"}}
 	cassandraService := Service{
-		Name:             Cassandra,
-		UrlTemplate:      "https://downloads.apache.org/cassandra/{{.Version}}/apache-cassandra-{{.Version}}-bin.tar.gz",
-		Versions:         createVersionMap(&cassandraVersions),
-		SelectedVersion:  "v3.11.7",
-		InstallationPath: filepath.FromSlash(home + "/.bin" + "/" + Cassandra),
-		IsEnabled:        true,
+		Name:                 Cassandra,
+		UrlTemplate:          "https://downloads.apache.org/cassandra/{{.Version}}/apache-cassandra-{{.Version}}-bin.tar.gz",
+		MirrorUrlTemplates:   []string{"https://archive.apache.org/dist/cassandra/{{.Version}}/apache-cassandra-{{.Version}}-bin.tar.gz"},
+		ChecksumUrlTemplate:  "{{.Url}}.sha512",
+		SignatureUrlTemplate: "{{.Url}}.asc",
+		KeysUrl:              "https://downloads.apache.org/cassandra/KEYS",
+		Versions:             createVersionMap(&cassandraVersions),
+		SelectedVersion:      "v3.11.7",
+		InstallationPath:     filepath.FromSlash(home + "/.bin" + "/" + Cassandra),
+		IsEnabled:            true,
 	}
 
 	dynamoDbVersions := []VersionMap{{"Name": "Asia_Pacific_(Mumbai)_Region", "Region": "ap-south-1", "RegionName": "-mumbai"}, {"Name": "Asia_Pacific_(Singapore)_Region", "Region": "ap-southeast-1", "RegionName": "-singapore"},
 		{"Name": "Asia_Pacific_(Tokyo)_Region", "Region": "ap-northeast-1", "RegionName": "-tokyo"}, {"Name": "Europe_(Frankfurt)_Region", "Region": "eu-central-1", "RegionName": "-frankfurt"},
 		{"Name": "South_America_(São_Paulo)_Region", "Region": "sa-east-1", "RegionName": "-sao-paulo"}, {"Name": "US_West_(Oregon)_Region", "Region": "us-west-2", "RegionName": ""}}
 	dynamoDbService := Service{
-		Name:             DynamoDb,
-		UrlTemplate:      "https://s3.{{.Region}}.amazonaws.com/dynamodb-local{{.RegionName}}/dynamodb_local_latest.tar.gz",
-		Versions:         createVersionMap(&dynamoDbVersions),
-		SelectedVersion:  "US_West_(Oregon)_Region",
-		InstallationPath: filepath.FromSlash(home + "/.bin" + "/" + DynamoDb),
-		IsEnabled:        true,
+		Name:                DynamoDb,
+		UrlTemplate:         "https://s3.{{.Region}}.amazonaws.com/dynamodb-local{{.RegionName}}/dynamodb_local_latest.tar.gz",
+		ChecksumUrlTemplate: "{{.Url}}.sha256",
+		Versions:            createVersionMap(&dynamoDbVersions),
+		SelectedVersion:     "US_West_(Oregon)_Region",
+		InstallationPath:    filepath.FromSlash(home + "/.bin" + "/" + DynamoDb),
+		IsEnabled:           true,
 	}
 
 	services := make(map[string]Service)
@@ -0,0 +1,143 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// Point HOME and XDG_CONFIG_HOME at temporary directories, returning them
+func setTestHome(t *testing.T) (string, string) {
+	home := t.TempDir()
+	configHome := filepath.Join(t.TempDir(), "config")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv(ConfigEnv, "")
+
+	// homedir caches the HOME of the first call
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	return home, configHome
+}
+
+func writeTestFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("version: \"1.1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// The --config flag and SETUP_CONFIG env var, and which of the default config files exist
+		flag, env               string
+		xdgExists, legacyExists bool
+		unsetConfigHome         bool
+		want                    func(home string, configHome string) string
+	}{
+		{
+			name: "--config", flag: "flag.yml", env: "env.yml", xdgExists: true, legacyExists: true,
+			want: func(home string, configHome string) string { return "flag.yml" },
+		},
+		{
+			name: "SETUP_CONFIG", env: "env.yml", xdgExists: true, legacyExists: true,
+			want: func(home string, configHome string) string { return "env.yml" },
+		},
+		{
+			name: "existing XDG config file", xdgExists: true, legacyExists: true,
+			want: func(home string, configHome string) string {
+				return filepath.Join(configHome, "setup", XdgConfigFileName)
+			},
+		},
+		{
+			name: "existing legacy config file", legacyExists: true,
+			want: func(home string, configHome string) string { return filepath.Join(home, LegacyConfigFileName) },
+		},
+		{
+			name: "XDG default",
+			want: func(home string, configHome string) string {
+				return filepath.Join(configHome, "setup", XdgConfigFileName)
+			},
+		},
+		{
+			name: "XDG default without XDG_CONFIG_HOME", unsetConfigHome: true,
+			want: func(home string, configHome string) string {
+				return filepath.Join(home, ".config", "setup", XdgConfigFileName)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home, configHome := setTestHome(t)
+			if tt.xdgExists {
+				writeTestFile(t, filepath.Join(configHome, "setup", XdgConfigFileName))
+			}
+			if tt.legacyExists {
+				writeTestFile(t, filepath.Join(home, LegacyConfigFileName))
+			}
+			if tt.unsetConfigHome {
+				t.Setenv("XDG_CONFIG_HOME", "")
+			}
+			t.Setenv(ConfigEnv, tt.env)
+			cfgFile = tt.flag
+			t.Cleanup(func() { cfgFile = "" })
+
+			configFile, err := resolveConfigFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.want(home, configHome); configFile != want {
+				t.Errorf("expected %s, got %s", want, configFile)
+			}
+		})
+	}
+}
+
+func TestConfigLockPath(t *testing.T) {
+	home, configHome := setTestHome(t)
+	configFile := filepath.Join(configHome, "setup", XdgConfigFileName)
+
+	lockPath, err := configLockPath(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(lockPath) != filepath.Join(home, SetupHomeDirName, "locks") {
+		t.Errorf("expected the lock under the setup home, got %s", lockPath)
+	}
+
+	otherLockPath, err := configLockPath(filepath.Join(home, LegacyConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherLockPath == lockPath {
+		t.Error("expected config files to have their own lock")
+	}
+}
@@ -0,0 +1,392 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/AlecAivazis/survey/v2"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Settings of the service added by service add
+var (
+	addUrlTemplate         string
+	addMirrorUrlTemplates  []string
+	addChecksumUrlTemplate string
+	addServiceType         string
+	addBinaryName          string
+	addVersion             string
+	addPath                string
+)
+
+var uninstallRemovedService bool
+
+// Service names are used in paths, service@version args and config key paths like
+// services.<service>.path, so they are limited to characters which are safe in all of them
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "add or remove services",
+	Long: `add or remove services.
+Besides the services setup comes with, any service which is downloaded as an archive
+or a single binary from a url can be added.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var serviceAddCmd = &cobra.Command{
+	Use:   "add [service] [KEY=VALUE]...",
+	Short: "add a service to the configuration",
+	Long: `add a service to the configuration.
+The KEY=VALUE arguments are the template fields of the version given by --version,
+which the url templates refer to as {{.KEY}}. Version defaults to the version name.
+The url templates are checked against the version before the service is saved.
+A wizard asks for the service, --url-template and --version when they aren't given.
+More versions can be added with setup config set or setup config edit.
+
+Examples:
+	setup service add elasticsearch --url-template 'https://artifacts.elastic.co/downloads/elasticsearch/elasticsearch-{{.Version}}-linux-x86_64.tar.gz' --version 7.10.2 Version=7.10.2 --path ~/.bin/es
+	setup service add kubectl --type binary --url-template 'https://dl.k8s.io/release/v{{.Version}}/bin/linux/amd64/kubectl' --version 1.28.0
+	setup service add
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service, err := serviceToAdd(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		configFile := viper.ConfigFileUsed()
+		err = updateApplicationConfiguration(cmd.Context(), func(applicationConfiguration *Configuration) error {
+			if _, exists := applicationConfiguration.Services[service.Name]; exists {
+				return errors.New("Service " + service.Name + " already exists")
+			}
+			if applicationConfiguration.Services == nil {
+				applicationConfiguration.Services = make(map[string]Service)
+			}
+			applicationConfiguration.Services[service.Name] = service
+
+			content, err := configDocumentContent(configFile, applicationConfiguration, "")
+			if err != nil {
+				return err
+			}
+			// Other services may have problems already, which don't stop adding a service
+			problems := serviceConfigProblems(validateConfigurationContent(applicationConfiguration, content), []string{service.Name})
+			if len(problems) > 0 {
+				return configProblemsErrorf(configFile, problems, "Not adding service %s, the config file would have %d error(s):", service.Name, len(problems))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Added service", service.Name, "with version", service.SelectedVersion, "Install it with: setup install", service.Name)
+		return nil
+	},
+}
+
+var serviceRemoveCmd = &cobra.Command{
+	Use:   "remove <service>",
+	Short: "remove a service from the configuration",
+	Long: `remove a service from the configuration.
+Services with installed versions are only removed with --uninstall, which deletes the
+installed versions like setup uninstall does.
+
+Examples:
+	setup service remove elasticsearch
+	setup service remove elasticsearch --uninstall
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serviceName := args[0]
+		var installationPath string
+		var uninstallErr error
+		err := updateApplicationConfiguration(cmd.Context(), func(applicationConfiguration *Configuration) error {
+			service, exists := applicationConfiguration.Services[serviceName]
+			if !exists {
+				return errors.New("Unknown service: " + serviceName)
+			}
+
+			if len(service.InstalledVersion) > 0 && !uninstallRemovedService {
+				return errors.New("Service " + serviceName + " has installed versions " + strings.Join(service.InstalledVersion, ", ") + ". Pass --uninstall to delete them")
+			}
+			// The service is kept when a version fails to uninstall, but the versions deleted
+			// before are saved as uninstalled
+			for _, version := range append([]string{}, service.InstalledVersion...) {
+				uninstallErr = uninstallServiceVersion(cmd.Context(), applicationConfiguration, serviceName, version)
+				if uninstallErr != nil {
+					return nil
+				}
+			}
+
+			installationPath = service.InstallationPath
+			delete(applicationConfiguration.Services, serviceName)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if uninstallErr != nil {
+			return errors.New("Service " + serviceName + " wasn't removed. Error: " + uninstallErr.Error())
+		}
+
+		// Only removed when empty, as the path may have been shared with other files
+		if err = os.Remove(installationPath); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Kept installation path", installationPath, "of service", serviceName, "Error is: ", err.Error())
+		}
+		fmt.Println("Removed service", serviceName)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceAddCmd)
+	serviceCmd.AddCommand(serviceRemoveCmd)
+
+	serviceAddCmd.Flags().StringVar(&addUrlTemplate, "url-template", "", "url template of the download, e.g. https://example.com/{{.Version}}/app-{{.Version}}.tar.gz")
+	serviceAddCmd.Flags().StringArrayVar(&addMirrorUrlTemplates, "mirror-url-template", nil, "url template tried when the download from --url-template fails, can be repeated")
+	serviceAddCmd.Flags().StringVar(&addChecksumUrlTemplate, "checksum-url-template", "", "url template of a checksum file to verify the download with, e.g. {{.Url}}.sha512")
+	serviceAddCmd.Flags().StringVar(&addServiceType, "type", ArchiveServiceType, "type of the download: "+ArchiveServiceType+" or "+BinaryServiceType)
+	serviceAddCmd.Flags().StringVar(&addBinaryName, "binary-name", "", "name of the installed executable of a binary service, defaults to the service name")
+	serviceAddCmd.Flags().StringVar(&addVersion, "version", "", "name of the version the KEY=VALUE arguments belong to")
+	serviceAddCmd.Flags().StringVar(&addPath, "path", "", "installation path, defaults to ~/.bin/<service>")
+
+	serviceRemoveCmd.Flags().BoolVar(&uninstallRemovedService, "uninstall", false, "delete the installed versions of the service")
+}
+
+// Build the service to add from args and flags, asking for the settings missing in them
+func serviceToAdd(cmd *cobra.Command, args []string) (Service, error) {
+
+	serviceName := ""
+	var fieldArgs []string
+	if len(args) > 0 {
+		serviceName, fieldArgs = args[0], args[1:]
+	}
+	versionFields, err := parseVersionFields(fieldArgs)
+	if err != nil {
+		return Service{}, err
+	}
+
+	if serviceName != "" {
+		if err = validateServiceName(serviceName); err != nil {
+			return Service{}, err
+		}
+	}
+
+	if serviceName == "" || addUrlTemplate == "" || addVersion == "" {
+		err = promptServiceToAdd(cmd, &serviceName, versionFields)
+		if err != nil {
+			return Service{}, err
+		}
+	}
+
+	if addServiceType != ArchiveServiceType && addServiceType != BinaryServiceType {
+		return Service{}, errors.New("unknown type " + addServiceType + ", must be " + ArchiveServiceType + " or " + BinaryServiceType)
+	}
+
+	installationPath, err := serviceInstallationPath(serviceName, addPath)
+	if err != nil {
+		return Service{}, err
+	}
+
+	service := Service{
+		Name:                serviceName,
+		BinaryName:          addBinaryName,
+		UrlTemplate:         addUrlTemplate,
+		MirrorUrlTemplates:  addMirrorUrlTemplates,
+		ChecksumUrlTemplate: addChecksumUrlTemplate,
+		InstallationPath:    installationPath,
+		IsEnabled:           true,
+		Versions:            map[string]VersionMap{addVersion: newVersionMap(addVersion, versionFields)},
+		SelectedVersion:     addVersion,
+	}
+	// Archives are the default type, which isn't written to the config file
+	if addServiceType == BinaryServiceType {
+		service.Type = BinaryServiceType
+	}
+	return service, nil
+}
+
+// Check serviceName can be used as the name of a new service
+func validateServiceName(serviceName string) error {
+	if !serviceNamePattern.MatchString(serviceName) {
+		return errors.New("invalid service name " + strconv.Quote(serviceName) + ", it must start with a lowercase letter or digit followed by lowercase letters, digits, _ or -")
+	}
+	if serviceName == AllKey {
+		return errors.New("invalid service name " + serviceName + ", it is reserved to install all services")
+	}
+	return nil
+}
+
+// Parse KEY=VALUE arguments into the template fields of a version
+func parseVersionFields(args []string) (VersionMap, error) {
+	versionFields := make(VersionMap)
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			return nil, errors.New("invalid version field " + arg + ", expected KEY=VALUE")
+		}
+		versionFields[key] = value
+	}
+	return versionFields, nil
+}
+
+// The template fields of version, with Name set to version and Version defaulting to it
+func newVersionMap(version string, versionFields VersionMap) VersionMap {
+	versionMap := VersionMap{"Name": version, "Version": version}
+	for key, value := range versionFields {
+		if key != "Name" {
+			versionMap[key] = value
+		}
+	}
+	return versionMap
+}
+
+func serviceInstallationPath(serviceName string, path string) (string, error) {
+	if path == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.FromSlash(home + "/.bin" + "/" + serviceName), nil
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// Wizard asking for the service, url template, version and the other settings not given as flags
+func promptServiceToAdd(cmd *cobra.Command, serviceName *string, versionFields VersionMap) error {
+
+	if !isInteractive() {
+		return errors.New("stdin is not a terminal, unable to prompt for the service. Pass the service, --url-template and --version, e.g. setup service add elasticsearch --url-template 'https://artifacts.elastic.co/downloads/elasticsearch/elasticsearch-{{.Version}}-linux-x86_64.tar.gz' --version 7.10.2")
+	}
+
+	applicationConfiguration, err := initializeApplicationConfiguration()
+	if err != nil {
+		return err
+	}
+
+	if *serviceName == "" {
+		err = survey.AskOne(&survey.Input{Message: "Service name:"}, serviceName, survey.WithValidator(survey.Required), survey.WithValidator(func(answer interface{}) error {
+			if err := validateServiceName(answer.(string)); err != nil {
+				return err
+			}
+			if _, exists := applicationConfiguration.Services[answer.(string)]; exists {
+				return errors.New("service " + answer.(string) + " already exists")
+			}
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !cmd.Flags().Changed("type") {
+		err = survey.AskOne(&survey.Select{
+			Message: "Type of the download:",
+			Help:    "Archives are extracted into the version directory, binaries are installed as bin/<service>",
+			Options: []string{ArchiveServiceType, BinaryServiceType},
+			Default: addServiceType,
+		}, &addServiceType)
+		if err != nil {
+			return err
+		}
+	}
+
+	if addUrlTemplate == "" {
+		err = survey.AskOne(&survey.Input{
+			Message: "Url template:",
+			Help:    "Download url, referring to template fields of the version like {{.Version}}, e.g. https://example.com/{{.Version}}/app-{{.Version}}.tar.gz",
+		}, &addUrlTemplate, survey.WithValidator(survey.Required), survey.WithValidator(func(answer interface{}) error {
+			// The template is rendered once the fields of the version are known, only its syntax can be checked yet
+			_, err := template.New("UrlTemplate").Parse(answer.(string))
+			return err
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	if addVersion == "" {
+		err = survey.AskOne(&survey.Input{Message: "Version:", Help: "Name of the version, e.g. 7.10.2"}, &addVersion, survey.WithValidator(survey.Required))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(versionFields) == 0 {
+		fieldsAnswer := ""
+		err = survey.AskOne(&survey.Input{
+			Message: "Template fields of the version:",
+			Help:    "KEY=VALUE pairs separated by spaces, which the url template refers to as {{.KEY}}. Version defaults to the version name",
+			Default: "Version=" + addVersion,
+		}, &fieldsAnswer, survey.WithValidator(func(answer interface{}) error {
+			fields, err := parseVersionFields(strings.Fields(answer.(string)))
+			if err != nil {
+				return err
+			}
+			_, err = renderTemplate("UrlTemplate", addUrlTemplate, newVersionMap(addVersion, fields))
+			return err
+		}))
+		if err != nil {
+			return err
+		}
+		fields, _ := parseVersionFields(strings.Fields(fieldsAnswer))
+		for key, value := range fields {
+			versionFields[key] = value
+		}
+	}
+
+	if addPath == "" {
+		defaultPath, err := serviceInstallationPath(*serviceName, "")
+		if err != nil {
+			return err
+		}
+		err = survey.AskOne(&survey.Input{Message: "Installation path:", Default: defaultPath}, &addPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
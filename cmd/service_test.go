@@ -0,0 +1,60 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestValidateServiceName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"elasticsearch", true},
+		{"kafka-connect", true},
+		{"redis_7", true},
+		{"2fa", true},
+		{"", false},
+		{AllKey, false},
+		{"es@7", false},
+		{"es.7", false},
+		{"../..", false},
+		{"es/7", false},
+		{"-es", false},
+		{"Elasticsearch", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateServiceName(tt.name)
+			if tt.valid && err != nil {
+				t.Errorf("validateServiceName(%q) = %v, want no error", tt.name, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("validateServiceName(%q) succeeded, want an error", tt.name)
+			}
+		})
+	}
+}
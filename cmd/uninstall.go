@@ -0,0 +1,211 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"com.github/RawSanj/setup/util"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// uninstallCmd represents the uninstall command
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall [service@version]...",
+	Short: "uninstall one or more installed versions of a service",
+	Long: `uninstall one or more installed versions of a service.
+The version directory is deleted from the installation path and the configuration is updated.
+If the active version is removed, the most recently installed remaining version becomes active.
+
+Examples:
+	setup uninstall kafka@kafka-2.13-2.5.0
+	setup uninstall cassandra
+	setup uninstall
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		applicationConfiguration, err := initializeApplicationConfiguration()
+		if err != nil {
+			return err
+		}
+
+		versionsToUninstall, err := chooseVersionsToUninstall(&applicationConfiguration, args)
+		if err != nil {
+			return err
+		}
+
+		// Versions which were uninstalled are saved even when others fail
+		var uninstallErrors []string
+		err = updateApplicationConfiguration(cmd.Context(), func(latestConfiguration *Configuration) error {
+			uninstallErrors = nil
+			for _, serviceVersion := range versionsToUninstall {
+				serviceName, version := parseServiceArg(serviceVersion)
+				err := uninstallServiceVersion(cmd.Context(), latestConfiguration, serviceName, version)
+				if err != nil {
+					uninstallErrors = append(uninstallErrors, serviceVersion+": "+err.Error())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(uninstallErrors) > 0 {
+			return errors.New("failed to uninstall:\n\t" + strings.Join(uninstallErrors, "\n\t"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+}
+
+// Resolve the service@version pairs to uninstall from args, prompting for
+// versions when no args are given or an arg doesn't specify a version
+func chooseVersionsToUninstall(applicationConfiguration *Configuration, args []string) ([]string, error) {
+
+	if len(args) == 0 {
+		return selectInstalledVersions(installedServiceVersions(applicationConfiguration, ""))
+	}
+
+	versionsToUninstall := make([]string, 0, len(args))
+	for _, arg := range args {
+		serviceName, version := parseServiceArg(arg)
+		if _, exists := applicationConfiguration.Services[serviceName]; !exists {
+			return nil, errors.New("Unknown service: " + serviceName)
+		}
+
+		if version != "" {
+			versionsToUninstall = append(versionsToUninstall, serviceName+"@"+version)
+			continue
+		}
+
+		selectedVersions, err := selectInstalledVersions(installedServiceVersions(applicationConfiguration, serviceName))
+		if err != nil {
+			return nil, err
+		}
+		versionsToUninstall = append(versionsToUninstall, selectedVersions...)
+	}
+	return versionsToUninstall, nil
+}
+
+// List installed versions as service@version, for a single service or all services when serviceName is empty
+func installedServiceVersions(applicationConfiguration *Configuration, serviceName string) []string {
+
+	installedVersions := make([]string, 0)
+	for key, service := range applicationConfiguration.Services {
+		if serviceName != "" && key != serviceName {
+			continue
+		}
+		for _, version := range service.InstalledVersion {
+			installedVersions = append(installedVersions, key+"@"+version)
+		}
+	}
+	sort.Strings(installedVersions)
+	return installedVersions
+}
+
+func selectInstalledVersions(installedVersions []string) ([]string, error) {
+
+	if len(installedVersions) == 0 {
+		return nil, errors.New("no installed versions found to uninstall")
+	}
+
+	err := ensureInteractive()
+	if err != nil {
+		return nil, err
+	}
+
+	var selectedVersions []string
+
+	selectVersionsPrompt := &survey.MultiSelect{
+		Message:  "Select versions to be uninstalled",
+		Help:     fmt.Sprintf("Select one or more version from: %s to uninstall", installedVersions),
+		Options:  installedVersions,
+		PageSize: 10,
+	}
+
+	err = survey.AskOne(selectVersionsPrompt, &selectedVersions, survey.WithValidator(survey.Required))
+	if err != nil {
+		return nil, err
+	}
+	return selectedVersions, nil
+}
+
+// Delete InstallationPath/<version> and remove version from the service configuration
+func uninstallServiceVersion(ctx context.Context, applicationConfiguration *Configuration, serviceName string, version string) error {
+
+	service, exists := applicationConfiguration.Services[serviceName]
+	if !exists {
+		return errors.New("Unknown service: " + serviceName)
+	}
+
+	if installed, _ := util.HasElement(service.InstalledVersion, version); !installed {
+		return errors.New("version " + version + " of service " + serviceName + " is not installed")
+	}
+
+	versionLock, err := lockServiceVersion(ctx, service, version)
+	if err != nil {
+		return err
+	}
+	defer versionLock.Unlock()
+
+	err = os.RemoveAll(filepath.FromSlash(service.InstallationPath + "/" + version))
+	if err != nil {
+		return errors.New("Error Deleting Installation Directory. Error: " + err.Error())
+	}
+
+	updateConfigAfterUninstallation(service, version, applicationConfiguration)
+
+	if linkErr := updateCurrentLink(applicationConfiguration.Services[serviceName]); linkErr != nil {
+		fmt.Println("Error Linking Active Version for Service", serviceName, "Error is: ", linkErr.Error())
+	}
+	fmt.Println("Uninstalled", serviceName, version)
+
+	return nil
+}
+
+func updateConfigAfterUninstallation(service Service, version string, applicationConfiguration *Configuration) {
+	if installed, index := util.HasElement(service.InstalledVersion, version); installed {
+		service.InstalledVersion = util.RemoveIndex(service.InstalledVersion, index)
+	}
+
+	if service.ActiveVersion == version {
+		service.ActiveVersion = ""
+		if len(service.InstalledVersion) > 0 {
+			service.ActiveVersion = service.InstalledVersion[len(service.InstalledVersion)-1]
+		}
+	}
+
+	applicationConfiguration.Services[service.Name] = service
+}
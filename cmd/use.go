@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"com.github/RawSanj/setup/util"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// Name of the symlink in InstallationPath which points to the active version
+const CurrentLinkName = "current"
+
+// useCmd represents the use command
+var useCmd = &cobra.Command{
+	Use:   "use <service> <version>",
+	Short: "switch the active version of an installed service",
+	Long: `switch the active version of an installed service.
+The active version is linked as <path>/current, so scripts can always refer to
+e.g. ~/.bin/kafka/current/bin regardless of the installed version.
+
+Examples:
+	setup use kafka kafka-2.12-2.4.1
+	setup use kafka@kafka-2.12-2.4.1
+`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		serviceName, version := parseServiceArg(args[0])
+		if len(args) == 2 {
+			version = addUnderScore(args[1])
+		}
+		if version == "" {
+			return errors.New("please specify the version to use, e.g. setup use " + serviceName + " <version>")
+		}
+
+		return updateApplicationConfiguration(cmd.Context(), func(applicationConfiguration *Configuration) error {
+
+			service, exists := applicationConfiguration.Services[serviceName]
+			if !exists {
+				return errors.New("Unknown service: " + serviceName)
+			}
+
+			if installed, _ := util.HasElement(service.InstalledVersion, version); !installed {
+				return fmt.Errorf("version %s of service %s is not installed. Installed versions are: %s", version, serviceName, service.InstalledVersion)
+			}
+
+			service.ActiveVersion = version
+			applicationConfiguration.Services[serviceName] = service
+
+			err := updateCurrentLink(service)
+			if err != nil {
+				return errors.New("Error Linking Active Version. Error: " + err.Error())
+			}
+
+			fmt.Println("Using", serviceName, version)
+			return nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(useCmd)
+}
+
+// Point InstallationPath/current to the active version, or remove it when there is no active version
+func updateCurrentLink(service Service) error {
+
+	linkName := filepath.FromSlash(service.InstallationPath + "/" + CurrentLinkName)
+
+	if service.ActiveVersion == "" {
+		err := os.Remove(linkName)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return util.ReplaceSymlink(service.ActiveVersion, linkName)
+}
@@ -0,0 +1,247 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// Directory inside the cache where downloads are kept until they complete, so they can be resumed
+	PartialDownloadDir string = "partial"
+	// File inside each cache entry which records the url the entry was downloaded from
+	cacheSourceFileName string = ".source"
+)
+
+// CacheEntry is a downloaded archive kept in the download cache
+type CacheEntry struct {
+	Key      string
+	Path     string
+	Url      string
+	Size     int64
+	LastUsed time.Time
+}
+
+// DefaultCacheDir returns the user cache directory for setup, e.g. ~/.cache/setup on Linux
+func DefaultCacheDir() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, "setup"), nil
+}
+
+// CacheKey returns the key a download is stored under. Downloads with a known checksum are
+// content addressed, so the same archive is shared regardless of the mirror it came from.
+// Otherwise the key is derived from the url.
+func CacheKey(url string, checksum *Checksum) string {
+	if checksum != nil {
+		return checksum.Algorithm + "-" + checksum.Value
+	}
+	urlHash := sha256.Sum256([]byte(url))
+	return "url-" + hex.EncodeToString(urlHash[:])
+}
+
+// CachedFile looks up a download of any of urls in cacheDir. When checksum is not nil
+// the cached file is verified against it, and removed from the cache if it doesn't match.
+// When checksum is nil any entry downloaded from one of urls is used
+func CachedFile(cacheDir string, urls []string, checksum *Checksum) (string, bool) {
+
+	for _, url := range urls {
+		entryDir := filepath.Join(cacheDir, CacheKey(url, checksum))
+		entry, err := readCacheEntry(cacheDir, CacheKey(url, checksum))
+		if err != nil || entry.Path == entryDir {
+			continue
+		}
+
+		if checksum != nil && VerifyFileChecksum(entry.Path, checksum) != nil {
+			Println("Removing corrupt cache entry", entry.Path)
+			_ = os.RemoveAll(entryDir)
+			continue
+		}
+
+		return useCacheEntry(cacheDir, entry), true
+	}
+
+	// Without a checksum, archives cached under their checksum are found by the url they were downloaded from
+	if checksum == nil {
+		entries, _ := ListCache(cacheDir)
+		for _, entry := range entries {
+			if found, _ := HasElement(urls, entry.Url); found {
+				return useCacheEntry(cacheDir, entry), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Record the use of entry so prune keeps recently used entries, and return its path
+func useCacheEntry(cacheDir string, entry CacheEntry) string {
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(cacheDir, entry.Key), now, now)
+	return entry.Path
+}
+
+// AddToCache moves a downloaded file of url into cacheDir, named after the file of the url,
+// and returns its new path
+func AddToCache(cacheDir string, filePath string, url string, checksum *Checksum) (string, error) {
+
+	entryDir := filepath.Join(cacheDir, CacheKey(url, checksum))
+	err := os.RemoveAll(entryDir)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(entryDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	cachedFilePath := filepath.Join(entryDir, DownloadFileName(url))
+	err = os.Rename(filePath, cachedFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(filepath.Join(entryDir, cacheSourceFileName), []byte(url), 0644)
+	if err != nil {
+		return "", err
+	}
+	return cachedFilePath, nil
+}
+
+// ListCache returns the entries of cacheDir, most recently used first
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+
+	dirs, err := ioutil.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]CacheEntry, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() || dir.Name() == PartialDownloadDir {
+			continue
+		}
+
+		entry, err := readCacheEntry(cacheDir, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// PruneCache removes entries of cacheDir which haven't been used for longer than olderThan,
+// and returns the removed entries
+func PruneCache(cacheDir string, olderThan time.Duration) ([]CacheEntry, error) {
+
+	if olderThan <= 0 {
+		return nil, errors.New("age to prune must be greater than zero")
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	pruned := make([]CacheEntry, 0)
+	for _, entry := range entries {
+		if entry.LastUsed.After(cutoff) {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(cacheDir, entry.Key))
+		if err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
+
+// CleanCache removes all entries of cacheDir and returns the removed entries. Partial downloads
+// are kept, they may belong to a download which is still running
+func CleanCache(cacheDir string) ([]CacheEntry, error) {
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]CacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		err := os.RemoveAll(filepath.Join(cacheDir, entry.Key))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// Read the cache entry stored under key. Path is the entry directory itself when it doesn't hold an archive
+func readCacheEntry(cacheDir string, key string) (CacheEntry, error) {
+
+	entryDir := filepath.Join(cacheDir, key)
+	stat, err := os.Stat(entryDir)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	files, err := ioutil.ReadDir(entryDir)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	entry := CacheEntry{Key: key, Path: entryDir, LastUsed: stat.ModTime()}
+	for _, file := range files {
+		if file.Name() == cacheSourceFileName {
+			source, _ := os.ReadFile(filepath.Join(entryDir, file.Name()))
+			entry.Url = string(source)
+			continue
+		}
+		if !file.IsDir() {
+			entry.Path = filepath.Join(entryDir, file.Name())
+			entry.Size = file.Size()
+		}
+	}
+	return entry, nil
+}
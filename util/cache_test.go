@@ -0,0 +1,185 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	cacheTestUrl    = "https://archive.apache.org/dist/kafka/2.5.0/kafka_2.13-2.5.0.tgz"
+	cacheTestMirror = "https://downloads.apache.org/kafka/2.5.0/kafka_2.13-2.5.0.tgz"
+)
+
+// Adds a download of url with content to cacheDir as a finished download would
+func addTestFileToCache(t *testing.T, cacheDir string, url string, content string, checksum *Checksum) string {
+	downloadPath := filepath.Join(t.TempDir(), "download")
+	if err := os.WriteFile(downloadPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cachedPath, err := AddToCache(cacheDir, downloadPath, url, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cachedPath
+}
+
+func testChecksum(content string) *Checksum {
+	sum := sha256.Sum256([]byte(content))
+	return &Checksum{Algorithm: SHA256, Value: hex.EncodeToString(sum[:])}
+}
+
+func TestCacheKey(t *testing.T) {
+	checksum := testChecksum("kafka")
+	if got := CacheKey(cacheTestUrl, checksum); got != "sha256-"+checksum.Value {
+		t.Errorf("expected the checksum key, got %s", got)
+	}
+	if CacheKey(cacheTestUrl, checksum) != CacheKey(cacheTestMirror, checksum) {
+		t.Error("expected mirrors of the same checksum to share the key")
+	}
+
+	key := CacheKey(cacheTestUrl, nil)
+	if !strings.HasPrefix(key, "url-") {
+		t.Errorf("expected a url key, got %s", key)
+	}
+	if key == CacheKey(cacheTestMirror, nil) {
+		t.Error("expected different urls without a checksum to have different keys")
+	}
+}
+
+func TestCachedFileByChecksum(t *testing.T) {
+	cacheDir := t.TempDir()
+	checksum := testChecksum("kafka")
+	cachedPath := addTestFileToCache(t, cacheDir, cacheTestUrl, "kafka", checksum)
+
+	if filepath.Base(cachedPath) != "kafka_2.13-2.5.0.tgz" {
+		t.Errorf("expected the cached file to be named after the url, got %s", cachedPath)
+	}
+	if filepath.Base(filepath.Dir(cachedPath)) != CacheKey(cacheTestUrl, checksum) {
+		t.Errorf("expected the cached file under the checksum key, got %s", cachedPath)
+	}
+
+	// Downloads from any mirror share the entry of the checksum
+	path, found := CachedFile(cacheDir, []string{cacheTestMirror}, checksum)
+	if !found || path != cachedPath {
+		t.Errorf("expected %s to be found from the mirror, got %s, %v", cachedPath, path, found)
+	}
+
+	// Without a checksum the entry is found by the url it was downloaded from
+	path, found = CachedFile(cacheDir, []string{cacheTestUrl}, nil)
+	if !found || path != cachedPath {
+		t.Errorf("expected %s to be found by its url, got %s, %v", cachedPath, path, found)
+	}
+	if _, found = CachedFile(cacheDir, []string{cacheTestMirror}, nil); found {
+		t.Error("expected the entry not to be found by another url without a checksum")
+	}
+
+	// Another checksum is another archive
+	if _, found = CachedFile(cacheDir, []string{cacheTestUrl}, testChecksum("other")); found {
+		t.Error("expected the entry not to be found for another checksum")
+	}
+}
+
+func TestCachedFileByUrl(t *testing.T) {
+	cacheDir := t.TempDir()
+	cachedPath := addTestFileToCache(t, cacheDir, cacheTestUrl, "kafka", nil)
+
+	if filepath.Base(filepath.Dir(cachedPath)) != CacheKey(cacheTestUrl, nil) {
+		t.Errorf("expected the cached file under the url key, got %s", cachedPath)
+	}
+
+	path, found := CachedFile(cacheDir, []string{cacheTestMirror, cacheTestUrl}, nil)
+	if !found || path != cachedPath {
+		t.Errorf("expected %s to be found by its url, got %s, %v", cachedPath, path, found)
+	}
+	if _, found = CachedFile(cacheDir, []string{cacheTestMirror}, nil); found {
+		t.Error("expected the entry not to be found by another url")
+	}
+}
+
+func TestCachedFileRemovesCorruptEntry(t *testing.T) {
+	cacheDir := t.TempDir()
+	checksum := testChecksum("kafka")
+	cachedPath := addTestFileToCache(t, cacheDir, cacheTestUrl, "kafka", checksum)
+	if err := os.WriteFile(cachedPath, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := CachedFile(cacheDir, []string{cacheTestUrl}, checksum); found {
+		t.Error("expected a corrupt entry not to be used")
+	}
+	if _, err := os.Stat(filepath.Dir(cachedPath)); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupt entry to be removed, got %v", err)
+	}
+}
+
+func TestPruneAndCleanCacheKeepPartialDownloads(t *testing.T) {
+	cacheDir := t.TempDir()
+	oldPath := addTestFileToCache(t, cacheDir, cacheTestUrl, "kafka", nil)
+	recentPath := addTestFileToCache(t, cacheDir, cacheTestMirror, "kafka", testChecksum("kafka"))
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(filepath.Dir(oldPath), lastMonth, lastMonth); err != nil {
+		t.Fatal(err)
+	}
+	partialPath := filepath.Join(cacheDir, PartialDownloadDir, "kafka_2.13-2.5.0.tgz.tmp")
+	if err := os.MkdirAll(filepath.Dir(partialPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partialPath, []byte("kaf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != recentPath || entries[1].Path != oldPath {
+		t.Fatalf("expected the 2 entries most recently used first, got %+v", entries)
+	}
+
+	pruned, err := PruneCache(cacheDir, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Path != oldPath {
+		t.Fatalf("expected only %s to be pruned, got %+v", oldPath, pruned)
+	}
+
+	removed, err := CleanCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Path != recentPath {
+		t.Fatalf("expected only %s to be removed, got %+v", recentPath, removed)
+	}
+	if _, err := os.Stat(partialPath); err != nil {
+		t.Errorf("expected the partial download to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"os"
+	"strings"
+)
+
+const (
+	SHA256 string = "sha256"
+	SHA512 string = "sha512"
+)
+
+// Checksum is the expected digest of a downloaded file
+type Checksum struct {
+	Algorithm string
+	Value     string
+}
+
+// ParseChecksum reads a checksum from a literal configuration value or from the content of a published
+// checksum file. Supported formats are:
+//
+//	<hash>                                  plain hex digest
+//	sha512:<hash>                           digest with explicit algorithm
+//	<hash>  <file>                          sha256sum / sha512sum output
+//	<file>: 447A7057 BCD9FACA ...           gpg --print-md output, as published for Kafka
+//
+// The algorithm is derived from the digest length when it isn't given explicitly.
+func ParseChecksum(content string) (*Checksum, error) {
+
+	algorithm := ""
+	content = strings.TrimSpace(content)
+
+	if prefix, value, found := strings.Cut(content, ":"); found {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if prefix == SHA256 || prefix == SHA512 {
+			algorithm = prefix
+		}
+		content = value
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return nil, errors.New("checksum is empty")
+	}
+
+	value := strings.ToLower(fields[0])
+	if checksumAlgorithm(value) == "" {
+		// gpg --print-md splits the digest into space separated groups over multiple lines
+		value = strings.ToLower(strings.Join(fields, ""))
+	}
+
+	if _, err := hex.DecodeString(value); err != nil {
+		return nil, errors.New("checksum is not a valid hex digest: " + value)
+	}
+
+	lengthAlgorithm := checksumAlgorithm(value)
+	if lengthAlgorithm == "" {
+		return nil, errors.New("checksum is neither a sha256 nor a sha512 digest: " + value)
+	}
+	if algorithm != "" && algorithm != lengthAlgorithm {
+		return nil, errors.New("checksum length doesn't match algorithm " + algorithm + ": " + value)
+	}
+
+	return &Checksum{Algorithm: lengthAlgorithm, Value: value}, nil
+}
+
+// NewHash returns a hash.Hash for the checksum algorithm
+func (c *Checksum) NewHash() hash.Hash {
+	if c.Algorithm == SHA256 {
+		return sha256.New()
+	}
+	return sha512.New()
+}
+
+// Verify compares the sum of hasher against the expected checksum value
+func (c *Checksum) Verify(hasher hash.Hash) error {
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if actual != c.Value {
+		return errors.New(c.Algorithm + " checksum mismatch, expected " + c.Value + " but got " + actual)
+	}
+	return nil
+}
+
+// VerifyFileChecksum hashes fileName and compares it against the checksum
+func VerifyFileChecksum(fileName string, checksum *Checksum) error {
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+
+	hasher := checksum.NewHash()
+	err = hashFile(fileName, stat.Size(), hasher)
+	if err != nil {
+		return err
+	}
+	return checksum.Verify(hasher)
+}
+
+func checksumAlgorithm(value string) string {
+	switch len(value) {
+	case sha256.Size * 2:
+		return SHA256
+	case sha512.Size * 2:
+		return SHA512
+	}
+	return ""
+}
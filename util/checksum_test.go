@@ -0,0 +1,88 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksum(t *testing.T) {
+	sha256Sum := sha256.Sum256([]byte("kafka"))
+	sha256Value := hex.EncodeToString(sha256Sum[:])
+	sha512Sum := sha512.Sum512([]byte("kafka"))
+	sha512Value := hex.EncodeToString(sha512Sum[:])
+
+	// gpg --print-md SHA512 output as published by Apache, upper case groups of 8 over three lines
+	var groups []string
+	for i := 0; i < len(sha512Value); i += 8 {
+		groups = append(groups, strings.ToUpper(sha512Value[i:i+8]))
+	}
+	gpgPrintMd := "kafka_2.13-2.5.0.tgz: " + strings.Join(groups[:6], " ") + "\n" +
+		"                      " + strings.Join(groups[6:12], " ") + "\n" +
+		"                      " + strings.Join(groups[12:], " ") + "\n"
+
+	tests := []struct {
+		name      string
+		content   string
+		algorithm string
+		value     string
+		wantErr   string
+	}{
+		{name: "plain sha256", content: sha256Value, algorithm: SHA256, value: sha256Value},
+		{name: "plain sha512 with newline", content: sha512Value + "\n", algorithm: SHA512, value: sha512Value},
+		{name: "upper case", content: strings.ToUpper(sha256Value), algorithm: SHA256, value: sha256Value},
+		{name: "explicit algorithm", content: "sha512:" + sha512Value, algorithm: SHA512, value: sha512Value},
+		{name: "explicit upper case algorithm", content: "SHA256:" + sha256Value, algorithm: SHA256, value: sha256Value},
+		{name: "sha256sum output", content: sha256Value + "  dynamodb_local_latest.tar.gz\n", algorithm: SHA256, value: sha256Value},
+		{name: "sha512sum binary mode output", content: sha512Value + " *apache-cassandra-3.11.7-bin.tar.gz\n", algorithm: SHA512, value: sha512Value},
+		{name: "gpg print-md", content: gpgPrintMd, algorithm: SHA512, value: sha512Value},
+		{name: "empty", content: "  \n", wantErr: "empty"},
+		{name: "garbage", content: "<html>Not Found</html>", wantErr: "not a valid hex digest"},
+		{name: "wrong length", content: sha256Value[:40], wantErr: "neither a sha256 nor a sha512"},
+		{name: "algorithm mismatch", content: "sha512:" + sha256Value, wantErr: "doesn't match algorithm sha512"},
+		{name: "truncated gpg print-md", content: "kafka_2.13-2.5.0.tgz: " + strings.Join(groups[:6], " "), wantErr: "neither a sha256 nor a sha512"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum, err := ParseChecksum(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checksum.Algorithm != tt.algorithm || checksum.Value != tt.value {
+				t.Errorf("got %s:%s, want %s:%s", checksum.Algorithm, checksum.Value, tt.algorithm, tt.value)
+			}
+		})
+	}
+}
@@ -25,14 +25,17 @@ SOFTWARE.
 package util
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"reflect"
 )
 
-// Check if file exists and is not a directory
+// Check if file exists and is not a directory. Paths which can't be stat'ed, e.g. below a
+// regular file or in an unreadable directory, don't count as existing
 func FileExists(fileName string) bool {
 	stat, err := os.Stat(fileName)
-	if os.IsNotExist(err) {
+	if err != nil {
 		return false
 	}
 	return !stat.IsDir()
@@ -58,3 +61,71 @@ func HasElement(s interface{}, elem interface{}) (bool, int) {
 
 	return false, 0
 }
+
+// Point linkName at target, replacing any existing link. The new link is created
+// next to linkName and renamed over it so the link is never missing
+func ReplaceSymlink(target string, linkName string) error {
+	tempLinkName := linkName + ".tmp"
+	_ = os.Remove(tempLinkName)
+
+	err := os.Symlink(target, tempLinkName)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempLinkName, linkName)
+	if err != nil {
+		_ = os.Remove(tempLinkName)
+		return err
+	}
+	return nil
+}
+
+// WriteFileAtomic writes content to a temporary file in the directory of fileName and renames it
+// over fileName, so readers see either the old or the new content but never a partial file
+func WriteFileAtomic(fileName string, content []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), ".*-"+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), fileName)
+	}
+	return err
+}
+
+// CheckWritableDir checks that dir, or its closest existing parent when dir doesn't exist
+// yet, is a directory files can be created in
+func CheckWritableDir(dir string) error {
+	path := filepath.Clean(dir)
+	for {
+		stat, err := os.Stat(path)
+		if os.IsNotExist(err) && filepath.Dir(path) != path {
+			path = filepath.Dir(path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !stat.IsDir() {
+			return errors.New(path + " is not a directory")
+		}
+		break
+	}
+
+	testFile, err := os.CreateTemp(path, ".setup-write-test-")
+	if err != nil {
+		return errors.New(path + " is not writable")
+	}
+	_ = testFile.Close()
+	return os.Remove(testFile.Name())
+}
@@ -25,7 +25,12 @@ SOFTWARE.
 package util
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
@@ -37,16 +42,22 @@ import (
 
 // WriteCounter counts the number of bytes written to it. It implements to the io.Writer interface
 // and we can pass this into io.TeeReader() which will report progress on each write cycle.
+// With a Bar the progress is shown on the bar, otherwise on a single line of stdout.
 type WriteCounter struct {
 	Total uint64
 	Name  string
 	Size  uint64
+	Bar   *ProgressBar
 }
 
 func (wc *WriteCounter) Write(p []byte) (int, error) {
 	n := len(p)
 	wc.Total += uint64(n)
-	wc.PrintProgress()
+	if wc.Bar != nil {
+		wc.Bar.SetDownloaded(wc.Total)
+	} else {
+		wc.PrintProgress()
+	}
 	return n, nil
 }
 
@@ -60,49 +71,252 @@ func (wc WriteCounter) PrintProgress() {
 	fmt.Printf("\rDownloading [%s]... %s of %s completed.", wc.Name, humanize.Bytes(wc.Total), humanize.Bytes(wc.Size))
 }
 
+// Maximum size of small files like checksums and signatures read into memory by FetchContent
+const maxFetchContentSize = 10 * 1024 * 1024
+
 // DownloadFile will download a url to a local file. It's efficient because it will
 // write as it downloads and not load the whole file into memory. We pass an io.TeeReader
 // into Copy() to report progress on the download.
-func DownloadFile(fileDownloadPath string, url string) (string, error) {
+// When checksum is not nil the download is hashed while streaming and the file is
+// deleted if it doesn't match.
+// A failed download keeps its partial .tmp file, and the next call resumes it with a Range
+// request, as long as the server sent an ETag or Last-Modified validator to check the
+// remote file hasn't changed in between. Otherwise the file is downloaded from the start.
+// Progress is shown on bar, or on stdout when bar is nil. Cancelling ctx stops the download.
+func DownloadFile(ctx context.Context, fileDownloadPath string, url string, checksum *Checksum, bar *ProgressBar) (string, error) {
 
-	splitPath := strings.Split(url, "/")
-	fileName := splitPath[len(splitPath)-1]
-	absoluteFilePath := filepath.FromSlash(fileDownloadPath + "/" + fileName)
+	fileName := DownloadFileName(url)
+	absoluteFilePath := downloadFilePath(fileDownloadPath, url)
 
-	// Create the file, but give it a tmp file extension, this means we won't overwrite a
+	// Download into a file with a tmp file extension, this means we won't overwrite a
 	// file until it's downloaded, but we'll remove the tmp extension once downloaded.
-	out, err := os.Create(absoluteFilePath + ".tmp")
+	tmpFilePath := absoluteFilePath + ".tmp"
+	validatorFilePath := tmpFilePath + ".validator"
+
+	offset, validator := partialDownload(tmpFilePath, validatorFilePath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return absoluteFilePath, err
 	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
 
 	// Get the data
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		out.Close()
 		return absoluteFilePath, err
 	}
 	defer resp.Body.Close()
 
+	var out *os.File
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if responseValidator(resp) != validator || !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			resp.Body.Close()
+			discardPartialDownload(tmpFilePath, validatorFilePath)
+			return DownloadFile(ctx, fileDownloadPath, url, checksum, bar)
+		}
+		Println("Resuming download of", fileName, "from", humanize.Bytes(uint64(offset)))
+		out, err = os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_APPEND, 0644)
+
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		discardPartialDownload(tmpFilePath, validatorFilePath)
+		return DownloadFile(ctx, fileDownloadPath, url, checksum, bar)
+
+	case resp.StatusCode == http.StatusOK:
+		// Either a fresh download, or the server ignored the Range because it doesn't support
+		// ranges or the file changed. Both ways the whole file is sent
+		offset = 0
+		out, err = os.Create(tmpFilePath)
+		if err == nil {
+			err = os.WriteFile(validatorFilePath, []byte(responseValidator(resp)), 0644)
+		}
+
+	default:
+		return absoluteFilePath, &HTTPStatusError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if err != nil {
+		if out != nil {
+			out.Close()
+		}
+		return absoluteFilePath, err
+	}
+
 	// Create our progress reporter and pass it to be used alongside our writer
 	counter := &WriteCounter{
-		Name: fileName,
-		Size: uint64(resp.ContentLength),
+		Name:  fileName,
+		Total: uint64(offset),
+		Bar:   bar,
+	}
+	// ContentLength is -1 when the server doesn't send the length
+	if resp.ContentLength > 0 {
+		counter.Size = uint64(offset) + uint64(resp.ContentLength)
+	}
+	if bar != nil {
+		bar.StartDownload(fileName, counter.Total, counter.Size)
 	}
-	if _, err = io.Copy(out, io.TeeReader(resp.Body, counter)); err != nil {
+	var progressWriter io.Writer = counter
+	var hasher hash.Hash
+	if checksum != nil {
+		hasher = checksum.NewHash()
+		progressWriter = io.MultiWriter(counter, hasher)
+
+		// Bytes of a resumed download need to be part of the checksum too
+		if err = hashFile(tmpFilePath, offset, hasher); err != nil {
+			out.Close()
+			return absoluteFilePath, err
+		}
+	}
+	if _, err = io.Copy(out, io.TeeReader(resp.Body, progressWriter)); err != nil {
 		out.Close()
+		if bar == nil {
+			fmt.Print("\n")
+		}
+		// Only downloads with a validator can be resumed, don't leave the others behind
+		if responseValidator(resp) == "" {
+			discardPartialDownload(tmpFilePath, validatorFilePath)
+		}
 		return absoluteFilePath, err
 	}
 
 	// The progress use the same line so print a new line once it's finished downloading
-	fmt.Print("\n")
+	if bar == nil {
+		fmt.Print("\n")
+	}
 
 	// Close the file without defer so it can happen before Rename()
 	out.Close()
+	_ = os.Remove(validatorFilePath)
 
-	if err = os.Rename(absoluteFilePath+".tmp", absoluteFilePath); err != nil {
+	if checksum != nil {
+		if err = checksum.Verify(hasher); err != nil {
+			_ = os.Remove(tmpFilePath)
+			return absoluteFilePath, err
+		}
+	}
+
+	if err = os.Rename(tmpFilePath, absoluteFilePath); err != nil {
 		return absoluteFilePath, err
 	}
 
 	return absoluteFilePath, nil
 }
+
+// Path of the file url is downloaded to in fileDownloadPath. Different urls can share a file name,
+// like the same dynamodb_local_latest.tar.gz in every region, so the file is keyed by the whole url
+// to keep downloads of other urls apart
+func downloadFilePath(fileDownloadPath string, url string) string {
+	urlHash := sha256.Sum256([]byte(url))
+	return filepath.Join(fileDownloadPath, hex.EncodeToString(urlHash[:])+"-"+DownloadFileName(url))
+}
+
+// DownloadFileName returns the name of the file downloaded from url
+func DownloadFileName(url string) string {
+	splitPath := strings.Split(url, "/")
+	return splitPath[len(splitPath)-1]
+}
+
+// Return the size and validator of a partial download which can be resumed.
+// Offset is 0 when there is nothing to resume
+func partialDownload(tmpFilePath string, validatorFilePath string) (int64, string) {
+
+	validator, err := os.ReadFile(validatorFilePath)
+	if err != nil || len(validator) == 0 {
+		return 0, ""
+	}
+
+	stat, err := os.Stat(tmpFilePath)
+	if err != nil || stat.IsDir() {
+		return 0, ""
+	}
+
+	return stat.Size(), string(validator)
+}
+
+func discardPartialDownload(tmpFilePath string, validatorFilePath string) {
+	_ = os.Remove(tmpFilePath)
+	_ = os.Remove(validatorFilePath)
+}
+
+// Return the validator to resume a download with If-Range. Weak ETags can't be used
+// for ranges, so Last-Modified is used instead when the ETag is weak or missing
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// Write the first size bytes of fileName into hasher
+func hashFile(fileName string, size int64, hasher hash.Hash) error {
+	if size == 0 {
+		return nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(hasher, file, size)
+	return err
+}
+
+// DownloadFromMirrors downloads the file from the first of urls which succeeds. Transient
+// failures of each url are retried with DefaultRetryPolicy before moving on to the next one.
+// Returns the downloaded file path and the url it was downloaded from
+func DownloadFromMirrors(ctx context.Context, fileDownloadPath string, urls []string, checksum *Checksum, bar *ProgressBar) (string, string, error) {
+
+	lastErr := errors.New("no download url configured")
+	for _, url := range urls {
+		var downloadedFilePath string
+		err := DefaultRetryPolicy.Do(ctx, "Downloading "+url, func() error {
+			var err error
+			downloadedFilePath, err = DownloadFile(ctx, fileDownloadPath, url, checksum, bar)
+			return err
+		})
+		if err == nil {
+			return downloadedFilePath, url, nil
+		}
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+
+		Println("Error Downloading", url, "Error is: ", err.Error())
+		lastErr = err
+	}
+	return "", "", lastErr
+}
+
+// FetchContent downloads a small file like a checksum or signature into memory,
+// retrying transient failures with DefaultRetryPolicy
+func FetchContent(ctx context.Context, url string) ([]byte, error) {
+
+	var content []byte
+	err := DefaultRetryPolicy.Do(ctx, "Fetching "+url, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &HTTPStatusError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+
+		content, err = io.ReadAll(io.LimitReader(resp.Body, maxFetchContentSize))
+		return err
+	})
+	return content, err
+}
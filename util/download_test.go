@@ -0,0 +1,230 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var downloadContent = []byte(strings.Repeat("apache-cassandra-3.11.7-bin.tar.gz ", 100))
+
+// Serves downloadContent with ETag etag, honouring Range and If-Range like a real server
+func serveDownload(t *testing.T, etag string, requests *[]*http.Request) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "download.tar.gz", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Leaves a partial download of url in dir as an interrupted DownloadFile would
+func writePartialDownload(t *testing.T, dir string, url string, content []byte, validator string) string {
+	tmpFilePath := downloadFilePath(dir, url) + ".tmp"
+	if err := os.WriteFile(tmpFilePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tmpFilePath+".validator", []byte(validator), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tmpFilePath
+}
+
+func checkDownload(t *testing.T, filePath string, tmpFilePath string) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, downloadContent) {
+		t.Fatalf("downloaded %d bytes, expected %d bytes of the served file", len(content), len(downloadContent))
+	}
+	for _, leftover := range []string{tmpFilePath, tmpFilePath + ".validator"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", leftover, err)
+		}
+	}
+}
+
+func TestDownloadFileResumesPartialDownload(t *testing.T) {
+	var requests []*http.Request
+	server := serveDownload(t, `"v1"`, &requests)
+	url := server.URL + "/download.tar.gz"
+	dir := t.TempDir()
+	tmpFilePath := writePartialDownload(t, dir, url, downloadContent[:1000], `"v1"`)
+
+	filePath, err := DownloadFile(context.Background(), dir, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filePath, tmpFilePath)
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if got := requests[0].Header.Get("Range"); got != "bytes=1000-" {
+		t.Errorf("expected Range bytes=1000-, got %q", got)
+	}
+	if got := requests[0].Header.Get("If-Range"); got != `"v1"` {
+		t.Errorf("expected If-Range \"v1\", got %q", got)
+	}
+}
+
+func TestDownloadFileServerIgnoresRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(downloadContent)
+	}))
+	defer server.Close()
+	url := server.URL + "/download.tar.gz"
+	dir := t.TempDir()
+	tmpFilePath := writePartialDownload(t, dir, url, downloadContent[:1000], `"v1"`)
+
+	// The whole file is sent with 200, so it mustn't be appended to the partial download
+	filePath, err := DownloadFile(context.Background(), dir, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filePath, tmpFilePath)
+}
+
+func TestDownloadFileChangedValidator(t *testing.T) {
+	// A partial download of an older version of the file, If-Range doesn't match so the whole
+	// new file is sent
+	var requests []*http.Request
+	server := serveDownload(t, `"v2"`, &requests)
+	url := server.URL + "/download.tar.gz"
+	dir := t.TempDir()
+	tmpFilePath := writePartialDownload(t, dir, url, []byte("old version"), `"v1"`)
+
+	filePath, err := DownloadFile(context.Background(), dir, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filePath, tmpFilePath)
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+}
+
+func TestDownloadFileChangedValidatorOnPartialContent(t *testing.T) {
+	// A server that ignores If-Range answers with a range of the new file, which can't be
+	// appended to the old partial download
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		r.Header.Del("If-Range")
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "download.tar.gz", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+	defer server.Close()
+	url := server.URL + "/download.tar.gz"
+	dir := t.TempDir()
+	tmpFilePath := writePartialDownload(t, dir, url, []byte("old version"), `"v1"`)
+
+	filePath, err := DownloadFile(context.Background(), dir, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filePath, tmpFilePath)
+	if len(requests) != 2 {
+		t.Fatalf("expected the download to restart with a 2nd request, got %d requests", len(requests))
+	}
+	if got := requests[1].Header.Get("Range"); got != "" {
+		t.Errorf("expected the restarted download without Range, got %q", got)
+	}
+}
+
+func TestDownloadFileRangeNotSatisfiable(t *testing.T) {
+	// The partial download is longer than the file on the server, which answers with 416
+	var requests []*http.Request
+	server := serveDownload(t, `"v1"`, &requests)
+	url := server.URL + "/download.tar.gz"
+	dir := t.TempDir()
+	tmpFilePath := writePartialDownload(t, dir, url, append(downloadContent, "garbage"...), `"v1"`)
+
+	filePath, err := DownloadFile(context.Background(), dir, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filePath, tmpFilePath)
+	if len(requests) != 2 {
+		t.Fatalf("expected the download to restart with a 2nd request, got %d requests", len(requests))
+	}
+}
+
+func TestDownloadFileChecksum(t *testing.T) {
+	var requests []*http.Request
+	server := serveDownload(t, `"v1"`, &requests)
+	url := server.URL + "/download.tar.gz"
+	sum := sha256.Sum256(downloadContent)
+
+	t.Run("match on a resumed download", func(t *testing.T) {
+		dir := t.TempDir()
+		tmpFilePath := writePartialDownload(t, dir, url, downloadContent[:1000], `"v1"`)
+		checksum := &Checksum{Algorithm: SHA256, Value: hex.EncodeToString(sum[:])}
+
+		filePath, err := DownloadFile(context.Background(), dir, url, checksum, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDownload(t, filePath, tmpFilePath)
+	})
+
+	t.Run("mismatch deletes the download", func(t *testing.T) {
+		dir := t.TempDir()
+		tmpFilePath := downloadFilePath(dir, url) + ".tmp"
+		otherSum := sha256.Sum256([]byte("other"))
+		checksum := &Checksum{Algorithm: SHA256, Value: hex.EncodeToString(otherSum[:])}
+
+		filePath, err := DownloadFile(context.Background(), dir, url, checksum, nil)
+		if err == nil {
+			t.Fatal("expected a checksum error")
+		}
+		for _, leftover := range []string{filePath, tmpFilePath, tmpFilePath + ".validator"} {
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed, got %v", leftover, err)
+			}
+		}
+	})
+}
+
+func TestDownloadFileHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := DownloadFile(context.Background(), t.TempDir(), server.URL+"/download.tar.gz", nil, nil)
+	if err == nil || IsTransient(err) || !strings.Contains(err.Error(), fmt.Sprint(http.StatusNotFound)) {
+		t.Fatalf("expected a permanent 404 error, got %v", err)
+	}
+}
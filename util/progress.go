@@ -0,0 +1,274 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
+)
+
+// Minimum time between two redraws of the progress bars, so fast downloads don't flood the terminal
+const progressRedrawInterval = 100 * time.Millisecond
+
+// Progress is printed at these percentages when stdout is not a terminal
+const plainProgressStep = 25
+
+const progressBarWidth = 20
+
+// Progress shows one line per service while services are installed concurrently. On a
+// terminal the lines are redrawn in place, otherwise every change is printed as a new line
+type Progress struct {
+	mutex      sync.Mutex
+	out        io.Writer
+	terminal   bool
+	width      int
+	bars       []*ProgressBar
+	drawnLines int
+	lastDraw   time.Time
+}
+
+// ProgressBar is the progress line of a single service
+type ProgressBar struct {
+	progress    *Progress
+	name        string
+	status      string
+	fileName    string
+	total       uint64
+	size        uint64
+	startTotal  uint64
+	startTime   time.Time
+	plainStep   uint64
+	downloading bool
+}
+
+// The progress display in use, which Println writes above
+var activeProgress struct {
+	sync.Mutex
+	progress *Progress
+}
+
+// NewProgress creates a progress display writing to stdout, redrawing its lines in place
+// when stdout is a terminal
+func NewProgress() *Progress {
+	fd := os.Stdout.Fd()
+	progress := &Progress{
+		out:      os.Stdout,
+		terminal: isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd),
+		width:    80,
+	}
+	if width, _, err := term.GetSize(int(fd)); err == nil && width > 0 {
+		progress.width = width
+	}
+
+	activeProgress.Lock()
+	activeProgress.progress = progress
+	activeProgress.Unlock()
+	return progress
+}
+
+// Stop draws the final state of all bars, after which Println writes to stdout directly again
+func (p *Progress) Stop() {
+	p.mutex.Lock()
+	if p.terminal {
+		p.draw()
+	}
+	p.mutex.Unlock()
+
+	activeProgress.Lock()
+	if activeProgress.progress == p {
+		activeProgress.progress = nil
+	}
+	activeProgress.Unlock()
+}
+
+// Bar adds a line for name to the display
+func (p *Progress) Bar(name string, status string) *ProgressBar {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bar := &ProgressBar{progress: p, name: name, status: status}
+	p.bars = append(p.bars, bar)
+	if p.terminal {
+		p.draw()
+	}
+	return bar
+}
+
+// Println prints a message above the progress bars, or to stdout when no progress is shown
+func Println(a ...interface{}) {
+	activeProgress.Lock()
+	progress := activeProgress.progress
+	activeProgress.Unlock()
+
+	if progress == nil {
+		fmt.Println(a...)
+		return
+	}
+	progress.println(fmt.Sprintln(a...))
+}
+
+func (p *Progress) println(message string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.terminal {
+		fmt.Fprint(p.out, message)
+		return
+	}
+	p.clear()
+	fmt.Fprint(p.out, message)
+	p.draw()
+}
+
+// SetStatus changes the status shown for the bar, like extracting or installed
+func (b *ProgressBar) SetStatus(status string) {
+	p := b.progress
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b.status = status
+	b.downloading = false
+	if p.terminal {
+		p.draw()
+	} else {
+		fmt.Fprintf(p.out, "%s: %s\n", b.name, status)
+	}
+}
+
+// StartDownload switches the bar to show the download of fileName. Resumed downloads
+// start at offset, size is 0 when the server didn't send the length of the file
+func (b *ProgressBar) StartDownload(fileName string, offset uint64, size uint64) {
+	p := b.progress
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b.fileName = fileName
+	b.total = offset
+	b.startTotal = offset
+	b.size = size
+	b.startTime = time.Now()
+	b.plainStep = 0
+	b.downloading = true
+	if p.terminal {
+		p.draw()
+	} else if size > 0 {
+		fmt.Fprintf(p.out, "%s: downloading %s, %s\n", b.name, fileName, humanize.Bytes(size))
+	} else {
+		fmt.Fprintf(p.out, "%s: downloading %s\n", b.name, fileName)
+	}
+}
+
+// SetDownloaded updates the number of bytes downloaded so far
+func (b *ProgressBar) SetDownloaded(total uint64) {
+	p := b.progress
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b.total = total
+	if p.terminal {
+		if time.Since(p.lastDraw) >= progressRedrawInterval {
+			p.draw()
+		}
+		return
+	}
+
+	if b.size > 0 {
+		step := b.total * 100 / b.size / plainProgressStep
+		if step > b.plainStep && step*plainProgressStep < 100 {
+			b.plainStep = step
+			fmt.Fprintf(p.out, "%s: %d%% of %s, %s\n", b.name, step*plainProgressStep, humanize.Bytes(b.size), b.speedAndEta())
+		}
+	}
+}
+
+// Move the cursor to the first bar line and clear everything below it
+func (p *Progress) clear() {
+	if p.drawnLines > 0 {
+		fmt.Fprintf(p.out, "\033[%dA\r\033[J", p.drawnLines)
+	}
+	p.drawnLines = 0
+}
+
+func (p *Progress) draw() {
+	p.clear()
+
+	nameWidth := 0
+	for _, bar := range p.bars {
+		if len(bar.name) > nameWidth {
+			nameWidth = len(bar.name)
+		}
+	}
+
+	for _, bar := range p.bars {
+		line := fmt.Sprintf("%-*s  %s", nameWidth, bar.name, bar.line())
+		// Wrapped lines would break moving the cursor back up
+		if len(line) >= p.width {
+			line = line[:p.width-1]
+		}
+		fmt.Fprintln(p.out, line)
+	}
+	p.drawnLines = len(p.bars)
+	p.lastDraw = time.Now()
+}
+
+func (b *ProgressBar) line() string {
+	if !b.downloading {
+		return b.status
+	}
+
+	if b.size == 0 {
+		return fmt.Sprintf("%s %s", humanize.Bytes(b.total), b.speedAndEta())
+	}
+
+	total := b.total
+	if total > b.size {
+		total = b.size
+	}
+	filled := int(total * progressBarWidth / b.size)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	return fmt.Sprintf("[%s] %3d%% %s / %s %s", bar, total*100/b.size, humanize.Bytes(total), humanize.Bytes(b.size), b.speedAndEta())
+}
+
+func (b *ProgressBar) speedAndEta() string {
+	elapsed := time.Since(b.startTime).Seconds()
+	if elapsed < 0.5 || b.total <= b.startTotal {
+		return ""
+	}
+
+	speed := float64(b.total-b.startTotal) / elapsed
+	if b.size == 0 || b.total >= b.size {
+		return fmt.Sprintf("%s/s", humanize.Bytes(uint64(speed)))
+	}
+	eta := time.Duration(float64(b.size-b.total) / speed * float64(time.Second))
+	return fmt.Sprintf("%s/s ETA %s", humanize.Bytes(uint64(speed)), eta.Round(time.Second))
+}
@@ -0,0 +1,81 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+const armoredPublicKeyBlockStart = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+
+// ReadKeyRing reads the public keys of an Apache style KEYS file. These contain one armored
+// key block per release manager, separated by the gpg --list-sigs output of each key.
+// Key blocks which can't be parsed are skipped, as long as at least one key is readable
+func ReadKeyRing(keysFilePath string) (openpgp.EntityList, error) {
+
+	content, err := os.ReadFile(keysFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyRing openpgp.EntityList
+	blocks := strings.Split(string(content), armoredPublicKeyBlockStart)
+	for _, block := range blocks[1:] {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredPublicKeyBlockStart + block))
+		if err != nil {
+			continue
+		}
+		keyRing = append(keyRing, entities...)
+	}
+
+	if len(keyRing) == 0 {
+		return nil, errors.New("no readable public keys found in " + keysFilePath)
+	}
+	return keyRing, nil
+}
+
+// VerifySignature checks the armored detached signature of fileName against the keys in keyRing
+func VerifySignature(fileName string, signature []byte, keyRing openpgp.EntityList) error {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyRing, file, bytes.NewReader(signature), nil)
+	if err != nil {
+		return errors.New("signature verification failed for " + fileName + ". Error: " + err.Error())
+	}
+
+	Println("Verified signature of", filepath.Base(fileName), "from key", signer.PrimaryKey.KeyIdString())
+	return nil
+}
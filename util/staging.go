@@ -0,0 +1,77 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NewStagingDir creates a unique hidden directory in parentDir to install name into.
+// Being in parentDir keeps it on the same file system, so ReplaceDir can rename it into place
+func NewStagingDir(parentDir string, name string) (string, error) {
+
+	err := os.MkdirAll(parentDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return os.MkdirTemp(parentDir, "."+name+".staging-")
+}
+
+// RemoveStagingDir deletes a staging directory created by NewStagingDir with all its content
+func RemoveStagingDir(stagingDir string) {
+	if err := os.RemoveAll(stagingDir); err != nil {
+		Println("Error Removing Staging Directory", stagingDir, "Error is: ", err.Error())
+	}
+}
+
+// ReplaceDir renames stagedDir to targetDir. An existing targetDir is moved aside first
+// and only deleted once stagedDir is in place, or restored if the rename fails, so
+// targetDir never holds a mix of old and new content. Replacing takes two renames, which
+// isn't atomic: when the process dies in between, targetDir is missing and the old content
+// is left behind in the hidden staging directory next to it
+func ReplaceDir(stagedDir string, targetDir string) error {
+
+	backupDir := ""
+	if _, err := os.Lstat(targetDir); err == nil {
+		backupDir = filepath.Join(filepath.Dir(stagedDir), "."+filepath.Base(targetDir)+".old")
+		if err = os.Rename(targetDir, backupDir); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(stagedDir, targetDir); err != nil {
+		if backupDir != "" {
+			_ = os.Rename(backupDir, targetDir)
+		}
+		return err
+	}
+
+	if backupDir != "" {
+		return os.RemoveAll(backupDir)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStagedInstallReplacesVersionDir(t *testing.T) {
+	installationPath := t.TempDir()
+	versionDir := filepath.Join(installationPath, "kafka-2.13-2.5.0")
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "stale"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stagingDir, err := NewStagingDir(installationPath, "kafka-2.13-2.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stagedVersionDir := filepath.Join(stagingDir, "kafka-2.13-2.5.0")
+	if err := os.MkdirAll(stagedVersionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stagedVersionDir, "fresh"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplaceDir(stagedVersionDir, versionDir); err != nil {
+		t.Fatal(err)
+	}
+	RemoveStagingDir(stagingDir)
+
+	if !FileExists(filepath.Join(versionDir, "fresh")) || FileExists(filepath.Join(versionDir, "stale")) {
+		t.Error("version directory should only hold the staged content")
+	}
+	entries, err := os.ReadDir(installationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("staging directory was left behind, found %d entries", len(entries))
+	}
+}
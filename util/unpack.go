@@ -27,73 +27,587 @@ package util
 import (
 	"archive/tar"
 	"archive/zip"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ExtractLimits bound what an archive may extract to, to guard against decompression bombs
+type ExtractLimits struct {
+	// Maximum total uncompressed size of all files in bytes
+	MaxSize int64
+	// Maximum number of entries in the archive
+	MaxEntries int
+}
+
+// DefaultExtractLimits are applied by ExtractTarGz and Unzip. They are generous enough for
+// any development service distribution, but stop hostile archives from filling the disk
+var DefaultExtractLimits = ExtractLimits{
+	MaxSize:    8 * 1024 * 1024 * 1024,
+	MaxEntries: 200000,
+}
+
+// extractBudget tracks the entries and bytes extracted so far against the limits
+type extractBudget struct {
+	limits  ExtractLimits
+	entries int
+	size    int64
+}
+
+func (b *extractBudget) addEntry(name string) error {
+	b.entries++
+	if b.entries > b.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries, refusing to extract %s", b.limits.MaxEntries, name)
+	}
+	return nil
+}
+
+// Copy src to dst, failing once the total extracted size exceeds the limit
+func (b *extractBudget) copy(dst io.Writer, src io.Reader, name string) error {
+	remaining := b.limits.MaxSize - b.size
+	written, err := io.Copy(dst, io.LimitReader(src, remaining+1))
+	b.size += written
+	if err != nil {
+		return err
+	}
+	if written > remaining {
+		return fmt.Errorf("archive is larger than %d bytes uncompressed, refusing to extract %s", b.limits.MaxSize, name)
+	}
+	return nil
+}
+
+// contextReader fails reads once its context is done, so copying large archive entries stops on Ctrl-C
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// Resolve the archive entry name to a path inside extractDir. Absolute names and names
+// which would resolve outside of extractDir, like ../../.bashrc, are rejected
+func safeExtractPath(extractDir string, name string) (string, error) {
+
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errors.New("archive entry has an absolute path: " + name)
+	}
+
+	target := filepath.Join(extractDir, filepath.FromSlash(name))
+	relativePath, err := filepath.Rel(extractDir, target)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(os.PathSeparator)) {
+		return "", errors.New("archive entry is outside of the extraction directory: " + name)
+	}
+	return target, nil
+}
+
+// ExtractLayout selects which part of an archive ends up in the extraction directory.
+// StripComponents leading path components are removed from every entry name, and when
+// SubPath is set only entries below SubPath of the stripped names are extracted
+type ExtractLayout struct {
+	// Negative to flatten a single top level directory, if that's all the archive has
+	StripComponents int
+	SubPath         string
+}
+
+// DefaultExtractLayout flattens archives which have everything in a single top level directory
+var DefaultExtractLayout = ExtractLayout{StripComponents: -1}
+
+// Map an archive entry name to its name inside the extraction directory. Returns false
+// for entries which are stripped or outside of SubPath
+func (l ExtractLayout) entryName(name string) (string, bool) {
+
+	cleanName := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if cleanName == "" {
+		return "", false
+	}
+
+	components := strings.Split(cleanName, "/")
+	if l.StripComponents > 0 {
+		if len(components) <= l.StripComponents {
+			return "", false
+		}
+		components = components[l.StripComponents:]
+	}
+	entryName := strings.Join(components, "/")
+
+	if l.SubPath != "" {
+		subPath := strings.Trim(path.Clean("/"+filepath.ToSlash(l.SubPath)), "/")
+		if !strings.HasPrefix(entryName, subPath+"/") {
+			return "", false
+		}
+		entryName = strings.TrimPrefix(entryName, subPath+"/")
+	}
+	return entryName, true
+}
+
+// Flatten a single top level directory only when no layout is configured
+func (l ExtractLayout) flatten() bool {
+	return l.StripComponents < 0 && l.SubPath == ""
+}
+
+// Fail when a configured layout selected nothing, which happens with a wrong SubPath or
+// too many StripComponents
+func (l ExtractLayout) checkExtracted(entries int, source string) error {
+	if entries == 0 && !l.flatten() {
+		return fmt.Errorf("nothing extracted from %s with stripComponents %d and archiveSubPath %q", source, l.StripComponents, l.SubPath)
+	}
+	return nil
+}
+
+type ArchiveFormat string
+
+const (
+	FormatUnknown ArchiveFormat = ""
+	FormatGzip    ArchiveFormat = "gzip"
+	FormatBzip2   ArchiveFormat = "bzip2"
+	FormatXz      ArchiveFormat = "xz"
+	FormatZstd    ArchiveFormat = "zstd"
+	FormatZip     ArchiveFormat = "zip"
+	FormatTar     ArchiveFormat = "tar"
 )
 
+// Offset of the "ustar" magic in a tar header
+const tarMagicOffset = 257
+
+// DetectArchiveFormat sniffs the format of an archive from its magic bytes, regardless of its file extension
+func DetectArchiveFormat(filename string) (ArchiveFormat, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatGzip, nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return FormatBzip2, nil
+	case bytes.HasPrefix(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return FormatXz, nil
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatZstd, nil
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case len(header) >= tarMagicOffset+5 && bytes.Equal(header[tarMagicOffset:tarMagicOffset+5], []byte("ustar")):
+		return FormatTar, nil
+	}
+	return FormatUnknown, nil
+}
+
+// Extract extracts filename into extractDir, detecting the archive format from its content.
+// Supports zip, plain tar and tar compressed with gzip, bzip2, xz or zstd. The layout
+// selects which part of the archive is extracted. Cancelling ctx stops the extraction
+func Extract(ctx context.Context, filename, extractDir string, layout ExtractLayout) error {
+
+	format, err := DetectArchiveFormat(filename)
+	if err != nil {
+		Println("Error Opening File", filename)
+		return err
+	}
+
+	switch format {
+	case FormatZip:
+		return extractZip(ctx, filename, extractDir, layout)
+	case FormatUnknown:
+		return errors.New("unsupported archive format of " + filename + ". Supported formats are zip and tar, optionally compressed with gzip, bzip2, xz or zstd")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		Println("Error Opening File", filename)
+		return err
+	}
+	defer file.Close()
+
+	compressedStream := contextReader{ctx: ctx, reader: file}
+
+	var tarStream io.Reader
+	switch format {
+	case FormatGzip:
+		tarStream, err = gzip.NewReader(compressedStream)
+	case FormatBzip2:
+		tarStream = bzip2.NewReader(compressedStream)
+	case FormatXz:
+		tarStream, err = xz.NewReader(compressedStream)
+	case FormatZstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(compressedStream)
+		if err == nil {
+			defer decoder.Close()
+			tarStream = decoder
+		}
+	case FormatTar:
+		tarStream = compressedStream
+	}
+	if err != nil {
+		Println("Extract: opening", format, "stream failed")
+		return err
+	}
+
+	return extractTar(tarStream, extractDir, layout)
+}
+
+// InstallBinary copies a downloaded executable to binDir/name and sets its executable bit.
+// The file is copied rather than moved so the download cache keeps its copy
+func InstallBinary(ctx context.Context, filename, binDir, name string) error {
+
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return errors.New("invalid binary name " + name)
+	}
+
+	err := os.MkdirAll(binDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	source, err := os.Open(filename)
+	if err != nil {
+		Println("Error Opening File", filename)
+		return err
+	}
+	defer source.Close()
+
+	target := filepath.Join(binDir, name)
+	tmpTarget := target + ".tmp"
+	out, err := os.OpenFile(tmpTarget, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, contextReader{ctx: ctx, reader: source}); err != nil {
+		out.Close()
+		_ = os.Remove(tmpTarget)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		_ = os.Remove(tmpTarget)
+		return err
+	}
+
+	// OpenFile's mode is subject to umask, so set the executable bits explicitly
+	if err = os.Chmod(tmpTarget, 0755); err != nil {
+		_ = os.Remove(tmpTarget)
+		return err
+	}
+	return os.Rename(tmpTarget, target)
+}
+
+// ExtractTarGz extracts a tar.gz archive into extractDir
 func ExtractTarGz(filename, extractDir string) error {
 
 	gzipStream, err := os.Open(filename)
 	if err != nil {
-		fmt.Println("Error Opening File", filename)
+		Println("Error Opening File", filename)
 		return err
 	}
+	defer gzipStream.Close()
 
 	uncompressedStream, err := gzip.NewReader(gzipStream)
 	if err != nil {
-		fmt.Println("ExtractTarGz: NewReader failed")
+		Println("ExtractTarGz: NewReader failed")
 		return err
 	}
 
+	return extractTar(uncompressedStream, extractDir, DefaultExtractLayout)
+}
+
+// Extract a tar stream into extractDir, keeping file modes, modification times, symlinks
+// and hardlinks so extracted trees are runnable as is. PAX and GNU extended headers are
+// handled by archive/tar. Links may only point inside extractDir, and no entry is written
+// through a symlink.
+func extractTar(uncompressedStream io.Reader, extractDir string, layout ExtractLayout) error {
+
 	tarReader := tar.NewReader(uncompressedStream)
+	budget := &extractBudget{limits: DefaultExtractLimits}
+
+	err := os.MkdirAll(extractDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Directory modes and times are applied once extraction is done, so read only
+	// directories can still be filled and their times aren't changed by their contents
+	var dirHeaders []*tar.Header
+	entries := 0
 
 	for true {
 		header, err := tarReader.Next()
 
 		if err == io.EOF {
-			fmt.Println("Archive Extracted at", extractDir)
 			break
 		}
 
 		if err != nil {
-			fmt.Println("ExtractTarGz: Next() failed:", err.Error())
+			Println("Extract: Next() failed:", err.Error())
+			return err
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		if err := budget.addEntry(header.Name); err != nil {
+			return err
+		}
+
+		// Hostile names are rejected before the layout could strip their ../ components
+		if _, err := safeExtractPath(extractDir, header.Name); err != nil {
+			return err
+		}
+		name, selected := layout.entryName(header.Name)
+		if !selected {
+			continue
+		}
+		header.Name = name
+		if header.Typeflag == tar.TypeLink {
+			if _, err := safeExtractPath(extractDir, header.Linkname); err != nil {
+				return err
+			}
+			linkname, selected := layout.entryName(header.Linkname)
+			if !selected {
+				return errors.New("archive hardlink target is not extracted: " + header.Linkname)
+			}
+			header.Linkname = linkname
+		}
+		entries++
+
+		target, err := safeExtractPath(extractDir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := checkNoSymlinkInPath(extractDir, target); err != nil {
 			return err
 		}
 
 		switch header.Typeflag {
 
 		case tar.TypeDir:
-			if err := os.MkdirAll(filepath.FromSlash(extractDir+"/"+header.Name), 0755); err != nil {
-				fmt.Println("ExtractTarGz: Mkdir() failed:", err.Error())
+			if err := os.MkdirAll(target, 0755); err != nil {
+				Println("Extract: Mkdir() failed:", err.Error())
+				return err
 			}
+			dirHeaders = append(dirHeaders, header)
+
 		case tar.TypeReg:
-			outFile, err := os.Create(filepath.FromSlash(extractDir + "/" + header.Name))
-			if err != nil {
-				fmt.Println("ExtractTarGz: Create() failed:", err.Error())
+			if err := extractTarFile(target, header, tarReader, budget); err != nil {
+				Println("Extract: Copy() failed:", err.Error())
 				return err
 			}
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				fmt.Println("ExtractTarGz: Copy() failed:", err.Error())
+
+		case tar.TypeSymlink:
+			if err := extractTarSymlink(extractDir, target, header); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			if err := extractTarHardlink(extractDir, target, header); err != nil {
 				return err
 			}
-			_ = outFile.Close()
+
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			return errors.New("archive entry is a device node or fifo, refusing to extract: " + header.Name)
 
 		default:
-			fmt.Println(fmt.Sprintf("ExtractTarGz: uknown type: %s in %s",
+			Println(fmt.Sprintf("Extract: unknown type: %c in %s",
 				header.Typeflag,
 				header.Name))
 		}
 	}
 
-	return moveSingleDirToParent(extractDir)
+	for i := len(dirHeaders) - 1; i >= 0; i-- {
+		target, _ := safeExtractPath(extractDir, dirHeaders[i].Name)
+		_ = os.Chmod(target, dirHeaders[i].FileInfo().Mode().Perm()|0700)
+		_ = os.Chtimes(target, accessTime(dirHeaders[i]), dirHeaders[i].ModTime)
+	}
+
+	if err := layout.checkExtracted(entries, "archive"); err != nil {
+		return err
+	}
+	if layout.flatten() {
+		return moveSingleDirToParent(extractDir)
+	}
+	return nil
+}
+
+// Write a regular file entry with its permissions and modification time
+func extractTarFile(target string, header *tar.Header, tarReader *tar.Reader, budget *extractBudget) error {
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+
+	outFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := budget.copy(outFile, tarReader, header.Name); err != nil {
+		_ = outFile.Close()
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile's mode is subject to umask, so set the mode of the archive explicitly
+	if err := os.Chmod(target, header.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, accessTime(header), header.ModTime)
+}
+
+// Create a symlink entry, which must not point outside of extractDir
+func extractTarSymlink(extractDir string, target string, header *tar.Header) error {
+
+	linkName := filepath.FromSlash(header.Linkname)
+	if filepath.IsAbs(linkName) || strings.HasPrefix(header.Linkname, "/") {
+		return errors.New("archive symlink has an absolute target, refusing to extract: " + header.Name + " -> " + header.Linkname)
+	}
+
+	// A .. after a symlink is resolved from where the symlink points, not lexically, e.g.
+	// d -> . followed by e -> d/.. is the parent of extractDir. So .. may only follow
+	// directories, which can't be replaced by a symlink of a later entry
+	current := filepath.Dir(target)
+	notDir := ""
+	for _, component := range strings.Split(header.Linkname, "/") {
+		switch component {
+		case "", ".":
+		case "..":
+			if notDir != "" {
+				return errors.New("archive symlink resolves .. through " + notDir + " which isn't a directory, refusing to extract: " + header.Name + " -> " + header.Linkname)
+			}
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, component)
+			if notDir == "" {
+				if stat, err := os.Lstat(current); err != nil || !stat.IsDir() {
+					notDir = component
+				}
+			}
+		}
+	}
+
+	relativeTarget, err := filepath.Rel(extractDir, filepath.Join(filepath.Dir(target), linkName))
+	if err != nil || relativeTarget == ".." || strings.HasPrefix(relativeTarget, ".."+string(os.PathSeparator)) {
+		return errors.New("archive symlink points outside of the extraction directory: " + header.Name + " -> " + header.Linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	return os.Symlink(linkName, target)
+}
+
+// Create a hardlink entry. Hardlink names are relative to the archive root
+func extractTarHardlink(extractDir string, target string, header *tar.Header) error {
+
+	source, err := safeExtractPath(extractDir, header.Linkname)
+	if err != nil {
+		return err
+	}
+	if err := checkNoSymlinkInPath(extractDir, source); err != nil {
+		return err
+	}
+	// A hardlink to a symlink is a copy of the symlink, whose target would be resolved
+	// from the directory of the hardlink instead
+	if stat, err := os.Lstat(source); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+		return errors.New("archive hardlink points to a symlink, refusing to extract: " + header.Name + " -> " + header.Linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	return os.Link(source, target)
+}
+
+// Reject target when a directory between extractDir and target is a symlink, as writing
+// through it could escape extractDir, e.g. dir -> . followed by dir/../.bashrc
+func checkNoSymlinkInPath(extractDir string, target string) error {
+
+	relativePath, err := filepath.Rel(extractDir, filepath.Dir(target))
+	if err != nil || relativePath == "." {
+		return err
+	}
+
+	current := extractDir
+	for _, component := range strings.Split(relativePath, string(os.PathSeparator)) {
+		current = filepath.Join(current, component)
+		stat, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if stat.Mode()&os.ModeSymlink != 0 {
+			return errors.New("archive entry is inside a symlinked directory, refusing to extract: " + target)
+		}
+	}
+	return nil
+}
+
+// Remove a file or link at target left by an earlier entry of the same name, so a
+// new file is never written through an existing symlink
+func removeExisting(target string) error {
+	stat, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return errors.New("archive entry would replace a directory: " + target)
+	}
+	return os.Remove(target)
+}
+
+func accessTime(header *tar.Header) time.Time {
+	if header.AccessTime.IsZero() {
+		return header.ModTime
+	}
+	return header.AccessTime
 }
 
 func Unzip(filename, extractDir string) error {
+	return extractZip(context.Background(), filename, extractDir, DefaultExtractLayout)
+}
+
+func extractZip(ctx context.Context, filename, extractDir string, layout ExtractLayout) error {
 
 	r, err := zip.OpenReader(filename)
 	if err != nil {
@@ -101,45 +615,90 @@ func Unzip(filename, extractDir string) error {
 	}
 	defer r.Close()
 
+	budget := &extractBudget{limits: DefaultExtractLimits}
+	entries := 0
+
 	for _, f := range r.File {
-		rc, err := f.Open()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := budget.addEntry(f.Name); err != nil {
+			return err
+		}
+
+		if _, err := safeExtractPath(extractDir, f.Name); err != nil {
+			return err
+		}
+		name, selected := layout.entryName(f.Name)
+		if !selected {
+			continue
+		}
+		entries++
+
+		fpath, err := safeExtractPath(extractDir, name)
 		if err != nil {
 			return err
 		}
-		defer rc.Close()
 
-		fpath := filepath.Join(extractDir, f.Name)
 		if f.FileInfo().IsDir() {
-			err := os.MkdirAll(fpath, f.Mode())
+			err := os.MkdirAll(fpath, 0755)
 			if err != nil {
 				return err
 			}
-		} else {
-			var fdir string
-			if lastIndex := strings.LastIndex(fpath, string(os.PathSeparator)); lastIndex > -1 {
-				fdir = fpath[:lastIndex]
-			}
+			continue
+		}
 
-			err = os.MkdirAll(fdir, f.Mode())
-			if err != nil {
-				fmt.Println(err)
-				return err
-			}
-			f, err := os.OpenFile(
-				fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return err
-			}
-			defer f.Close()
+		if !f.Mode().IsRegular() {
+			return errors.New("archive entry is not a regular file, refusing to extract: " + f.Name)
+		}
 
-			_, err = io.Copy(f, rc)
-			if err != nil {
-				return err
-			}
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			Println(err)
+			return err
 		}
+
+		err = unzipFile(ctx, f, fpath, budget)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := layout.checkExtracted(entries, filename); err != nil {
+		return err
+	}
+	if layout.flatten() {
+		return moveSingleDirToParent(extractDir)
+	}
+	return nil
+}
+
+func unzipFile(ctx context.Context, f *zip.File, fpath string, budget *extractBudget) error {
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
+	if err != nil {
+		return err
 	}
 
-	return moveSingleDirToParent(extractDir)
+	if err := budget.copy(outFile, contextReader{ctx: ctx, reader: rc}, f.Name); err != nil {
+		_ = outFile.Close()
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile's mode is subject to umask, so set the mode of the archive explicitly
+	if err := os.Chmod(fpath, f.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(fpath, f.Modified, f.Modified)
 }
 
 func moveSingleDirToParent(extractDir string) error {
@@ -151,40 +710,32 @@ func moveSingleDirToParent(extractDir string) error {
 
 	if len(files) == 1 && files[0].IsDir() {
 
-		parentDirPath := filepath.Dir(extractDir)
-		extractDirName := filepath.Base(extractDir)
-		tempPath := filepath.FromSlash(parentDirPath + "/tmp/" + extractDirName)
-		oldPath := filepath.FromSlash(extractDir + "/" + files[0].Name())
-
-		// create parent/tmp directory
-		err := os.MkdirAll(filepath.FromSlash(parentDirPath+"/tmp"), 0755)
+		// Move the single directory out through a unique temporary directory next to
+		// extractDir, so concurrent installations never share it
+		tempDir, err := os.MkdirTemp(filepath.Dir(extractDir), "."+filepath.Base(extractDir)+".flatten-")
 		if err != nil {
 			return err
 		}
+		defer os.RemoveAll(tempDir)
 
-		// move parent/extractDir to parent/tmp/extractDir
-		err = os.Rename(oldPath, tempPath)
+		// move extractDir/singleDir to tempDir/singleDir
+		tempPath := filepath.Join(tempDir, files[0].Name())
+		err = os.Rename(filepath.Join(extractDir, files[0].Name()), tempPath)
 		if err != nil {
 			return err
 		}
 
-		// delete parent/extractDir
-		err = os.Remove(filepath.FromSlash(parentDirPath + "/" + extractDirName))
+		// delete the now empty extractDir
+		err = os.Remove(extractDir)
 		if err != nil {
 			return err
 		}
 
-		// move parent/tmp/extractDir to parent/extractDir
+		// move tempDir/singleDir to extractDir
 		err = os.Rename(tempPath, extractDir)
 		if err != nil {
 			return err
 		}
-
-		// delete parent/tmp
-		err = os.Remove(filepath.FromSlash(parentDirPath + "/tmp"))
-		if err != nil {
-			return err
-		}
 	}
 	return nil
 }
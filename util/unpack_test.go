@@ -0,0 +1,533 @@
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	size     int64
+	mode     int64
+	linkname string
+	modTime  time.Time
+}
+
+// Write a tar.gz built from entries into dir and return its path
+func writeTarGz(t *testing.T, dir string, entries []tarEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: 0644, Size: entry.size, Linkname: entry.linkname, ModTime: entry.modTime}
+		if entry.mode != 0 {
+			header.Mode = entry.mode
+		}
+		if entry.typeflag == tar.TypeReg && entry.size == 0 {
+			header.Size = int64(len(entry.body))
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			body := []byte(entry.body)
+			if entry.size > 0 {
+				body = bytes.Repeat([]byte("0"), int(entry.size))
+			}
+			if _, err := tarWriter.Write(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, "archive.tar.gz")
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestExtractTarGz(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := writeTarGz(t, dir, []tarEntry{
+		{name: "kafka_2.13-2.5.0/", typeflag: tar.TypeDir},
+		{name: "kafka_2.13-2.5.0/bin/", typeflag: tar.TypeDir},
+		{name: "kafka_2.13-2.5.0/bin/kafka-server-start.sh", typeflag: tar.TypeReg, body: "#!/bin/bash"},
+	})
+
+	extractDir := filepath.Join(dir, "kafka-2.13-2.5.0")
+	if err := ExtractTarGz(archivePath, extractDir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(extractDir, "bin", "kafka-server-start.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "#!/bin/bash" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestExtractDetectsFormatFromContent(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tarWriter := tar.NewWriter(&tarBuf)
+	body := "#!/bin/bash"
+	if err := tarWriter.WriteHeader(&tar.Header{Name: "cassandra/bin/cassandra", Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(body))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tarWriter.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	compress := func(newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		writer, err := newWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(tarBuf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	writer, err := zipWriter.Create("cassandra/bin/cassandra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format  ArchiveFormat
+		archive []byte
+	}{
+		{FormatTar, tarBuf.Bytes()},
+		{FormatGzip, compress(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })},
+		{FormatXz, compress(func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })},
+		{FormatZstd, compress(func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })},
+		{FormatZip, zipBuf.Bytes()},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			dir := t.TempDir()
+
+			// The extension is deliberately misleading, only the content decides the format
+			archivePath := filepath.Join(dir, "archive.tar.gz")
+			if err := os.WriteFile(archivePath, test.archive, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			format, err := DetectArchiveFormat(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != test.format {
+				t.Fatalf("detected format %q, expected %q", format, test.format)
+			}
+
+			extractDir := filepath.Join(dir, "extract")
+			if err := Extract(context.Background(), archivePath, extractDir, DefaultExtractLayout); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(filepath.Join(extractDir, "bin", "cassandra"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != body {
+				t.Errorf("unexpected content %q", content)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+		if err := os.WriteFile(archivePath, []byte("<html>Not Found</html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Extract(context.Background(), archivePath, filepath.Join(t.TempDir(), "extract"), DefaultExtractLayout); err == nil {
+			t.Fatal("expected an unsupported archive format error")
+		}
+	})
+}
+
+func TestExtractLayout(t *testing.T) {
+	entries := []tarEntry{
+		{name: "LICENSE", typeflag: tar.TypeReg, body: "license"},
+		{name: "kafka_2.13-2.5.0/", typeflag: tar.TypeDir},
+		{name: "kafka_2.13-2.5.0/bin/kafka-server-start.sh", typeflag: tar.TypeReg, body: "#!/bin/bash"},
+		{name: "kafka_2.13-2.5.0/bin/kafka-start.sh", typeflag: tar.TypeLink, linkname: "kafka_2.13-2.5.0/bin/kafka-server-start.sh"},
+		{name: "kafka_2.13-2.5.0/config/server.properties", typeflag: tar.TypeReg, body: "broker.id=0"},
+	}
+
+	tests := []struct {
+		name     string
+		layout   ExtractLayout
+		expected []string
+		missing  []string
+	}{
+		{"default keeps directory beside LICENSE", DefaultExtractLayout,
+			[]string{"LICENSE", "kafka_2.13-2.5.0/bin/kafka-server-start.sh"}, nil},
+		{"strip components", ExtractLayout{StripComponents: 1},
+			[]string{"bin/kafka-server-start.sh", "bin/kafka-start.sh", "config/server.properties"}, []string{"LICENSE"}},
+		{"archive sub path", ExtractLayout{SubPath: "kafka_2.13-2.5.0/bin"},
+			[]string{"kafka-server-start.sh", "kafka-start.sh"}, []string{"LICENSE", "server.properties"}},
+		{"strip components and sub path", ExtractLayout{StripComponents: 1, SubPath: "config"},
+			[]string{"server.properties"}, []string{"kafka-server-start.sh"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := writeTarGz(t, dir, entries)
+
+			extractDir := filepath.Join(dir, "extract")
+			if err := Extract(context.Background(), archivePath, extractDir, test.layout); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range test.expected {
+				if !FileExists(filepath.Join(extractDir, filepath.FromSlash(name))) {
+					t.Errorf("expected %s to be extracted", name)
+				}
+			}
+			for _, name := range test.missing {
+				if FileExists(filepath.Join(extractDir, filepath.FromSlash(name))) {
+					t.Errorf("expected %s not to be extracted", name)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown sub path", func(t *testing.T) {
+		dir := t.TempDir()
+		archivePath := writeTarGz(t, dir, entries)
+		if err := Extract(context.Background(), archivePath, filepath.Join(dir, "extract"), ExtractLayout{SubPath: "kafka/bin"}); err == nil {
+			t.Fatal("expected an error when archiveSubPath matches nothing")
+		}
+	})
+}
+
+func TestExtractTarGzKeepsModesTimesAndLinks(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2020, 4, 14, 10, 30, 0, 0, time.UTC)
+	archivePath := writeTarGz(t, dir, []tarEntry{
+		{name: "kafka_2.13-2.5.0/bin/", typeflag: tar.TypeDir, mode: 0755, modTime: modTime},
+		{name: "kafka_2.13-2.5.0/bin/kafka-run-class.sh", typeflag: tar.TypeReg, body: "#!/bin/bash", mode: 0755, modTime: modTime},
+		{name: "kafka_2.13-2.5.0/bin/kafka-run.sh", typeflag: tar.TypeSymlink, linkname: "kafka-run-class.sh"},
+		{name: "kafka_2.13-2.5.0/libs/kafka.jar", typeflag: tar.TypeReg, body: "jar", mode: 0644, modTime: modTime},
+		{name: "kafka_2.13-2.5.0/libs/kafka-link.jar", typeflag: tar.TypeLink, linkname: "kafka_2.13-2.5.0/libs/kafka.jar"},
+		{name: "kafka_2.13-2.5.0/config", typeflag: tar.TypeSymlink, linkname: "../kafka_2.13-2.5.0/libs"},
+	})
+
+	extractDir := filepath.Join(dir, "kafka-2.13-2.5.0")
+	if err := ExtractTarGz(archivePath, extractDir); err != nil {
+		t.Fatal(err)
+	}
+
+	script := filepath.Join(extractDir, "bin", "kafka-run-class.sh")
+	stat, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected %s to be executable, mode is %s", script, stat.Mode())
+	}
+	if !stat.ModTime().Equal(modTime) {
+		t.Errorf("expected modification time %s, got %s", modTime, stat.ModTime())
+	}
+
+	linkTarget, err := os.Readlink(filepath.Join(extractDir, "bin", "kafka-run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkTarget != "kafka-run-class.sh" {
+		t.Errorf("unexpected symlink target %s", linkTarget)
+	}
+
+	content, err := os.ReadFile(filepath.Join(extractDir, "libs", "kafka-link.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "jar" {
+		t.Errorf("unexpected hardlink content %q", content)
+	}
+}
+
+func TestExtractTarGzRejectsHostileArchives(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		limits  ExtractLimits
+		wantErr string
+	}{
+		{
+			name:    "parent traversal",
+			entries: []tarEntry{{name: "../../.bashrc", typeflag: tar.TypeReg, body: "evil"}},
+			wantErr: "outside of the extraction directory",
+		},
+		{
+			name: "nested traversal",
+			entries: []tarEntry{
+				{name: "kafka/", typeflag: tar.TypeDir},
+				{name: "kafka/../../.bashrc", typeflag: tar.TypeReg, body: "evil"},
+			},
+			wantErr: "outside of the extraction directory",
+		},
+		{
+			name:    "traversal through directory",
+			entries: []tarEntry{{name: "../outside/", typeflag: tar.TypeDir}},
+			wantErr: "outside of the extraction directory",
+		},
+		{
+			name:    "absolute path",
+			entries: []tarEntry{{name: "/tmp/.bashrc", typeflag: tar.TypeReg, body: "evil"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "absolute symlink",
+			entries: []tarEntry{{name: "passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}},
+			wantErr: "absolute target",
+		},
+		{
+			name:    "symlink escaping",
+			entries: []tarEntry{{name: "kafka/outside", typeflag: tar.TypeSymlink, linkname: "../../../outside"}},
+			wantErr: "points outside",
+		},
+		{
+			name: "symlink escaping through symlink",
+			entries: []tarEntry{
+				{name: "d", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "e", typeflag: tar.TypeSymlink, linkname: "d/.."},
+			},
+			wantErr: "isn't a directory",
+		},
+		{
+			name: "symlink escaping through later symlink",
+			entries: []tarEntry{
+				{name: "e", typeflag: tar.TypeSymlink, linkname: "d/.."},
+				{name: "d", typeflag: tar.TypeSymlink, linkname: "."},
+			},
+			wantErr: "isn't a directory",
+		},
+		{
+			name: "hardlink to escaping symlink",
+			entries: []tarEntry{
+				{name: "kafka/", typeflag: tar.TypeDir},
+				{name: "kafka/libs", typeflag: tar.TypeSymlink, linkname: "../outside"},
+				{name: "outside", typeflag: tar.TypeLink, linkname: "kafka/libs"},
+			},
+			wantErr: "points to a symlink",
+		},
+		{
+			name: "write through symlink",
+			entries: []tarEntry{
+				{name: "kafka", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "kafka/.bashrc", typeflag: tar.TypeReg, body: "evil"},
+			},
+			wantErr: "symlinked directory",
+		},
+		{
+			name:    "hardlink escaping",
+			entries: []tarEntry{{name: "passwd", typeflag: tar.TypeLink, linkname: "../../../etc/passwd"}},
+			wantErr: "outside of the extraction directory",
+		},
+		{
+			name:    "character device",
+			entries: []tarEntry{{name: "null", typeflag: tar.TypeChar}},
+			wantErr: "device node",
+		},
+		{
+			name:    "block device",
+			entries: []tarEntry{{name: "sda", typeflag: tar.TypeBlock}},
+			wantErr: "device node",
+		},
+		{
+			name:    "fifo",
+			entries: []tarEntry{{name: "pipe", typeflag: tar.TypeFifo}},
+			wantErr: "device node",
+		},
+		{
+			name: "too many entries",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeReg, body: "a"},
+				{name: "b", typeflag: tar.TypeReg, body: "b"},
+				{name: "c", typeflag: tar.TypeReg, body: "c"},
+			},
+			limits:  ExtractLimits{MaxSize: 1024, MaxEntries: 2},
+			wantErr: "more than 2 entries",
+		},
+		{
+			name: "too large",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeReg, size: 600},
+				{name: "b", typeflag: tar.TypeReg, size: 600},
+			},
+			limits:  ExtractLimits{MaxSize: 1024, MaxEntries: 10},
+			wantErr: "larger than 1024 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.limits != (ExtractLimits{}) {
+				defaultLimits := DefaultExtractLimits
+				DefaultExtractLimits = tt.limits
+				defer func() { DefaultExtractLimits = defaultLimits }()
+			}
+
+			dir := t.TempDir()
+			archivePath := writeTarGz(t, dir, tt.entries)
+			extractDir := filepath.Join(dir, "nested", "extract")
+
+			err := ExtractTarGz(archivePath, extractDir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			for _, escaped := range []string{filepath.Join(dir, ".bashrc"), filepath.Join(dir, "nested", ".bashrc"), filepath.Join(dir, "nested", "outside")} {
+				if _, err := os.Lstat(escaped); err == nil {
+					t.Errorf("%s was written outside of the extraction directory", escaped)
+				}
+			}
+		})
+	}
+}
+
+func TestUnzipRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../../.bashrc", "/tmp/.bashrc", "dynamodb/../../../.bashrc"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			writer, err := zipWriter.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write([]byte("evil")); err != nil {
+				t.Fatal(err)
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			archivePath := filepath.Join(dir, "archive.zip")
+			if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Unzip(archivePath, filepath.Join(dir, "nested", "extract")); err == nil {
+				t.Fatal("expected hostile zip entry to be rejected")
+			}
+			if _, err := os.Lstat(filepath.Join(dir, ".bashrc")); err == nil {
+				t.Error(".bashrc was written outside of the extraction directory")
+			}
+		})
+	}
+}
+
+func TestInstallBinary(t *testing.T) {
+	dir := t.TempDir()
+	downloadedFilePath := filepath.Join(dir, "tool-linux-amd64")
+	if err := os.WriteFile(downloadedFilePath, []byte("#!/bin/sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	binDir := filepath.Join(dir, "tool", "1.0", "bin")
+	if err := InstallBinary(context.Background(), downloadedFilePath, binDir, "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(filepath.Join(binDir, "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm()&0111 == 0 {
+		t.Errorf("binary is not executable, mode is %v", stat.Mode())
+	}
+	if !FileExists(downloadedFilePath) {
+		t.Error("downloaded file should be kept for the download cache")
+	}
+
+	if err := InstallBinary(context.Background(), downloadedFilePath, binDir, "../tool"); err == nil {
+		t.Error("expected binary name with a path to be rejected")
+	}
+}
+
+func TestExtractStopsWhenCancelled(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := writeTarGz(t, dir, []tarEntry{
+		{name: "cassandra/bin/cassandra", typeflag: tar.TypeReg, body: "#!/bin/bash"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Extract(ctx, archivePath, filepath.Join(dir, "extract"), DefaultExtractLayout)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
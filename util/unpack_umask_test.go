@@ -0,0 +1,89 @@
+//go:build !windows
+
+/*
+MIT License
+
+Copyright (c) 2020 Sanjay Rawat - https://rawsanj.dev
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestExtractKeepsModesUnderUmask(t *testing.T) {
+	oldUmask := syscall.Umask(0027)
+	defer syscall.Umask(oldUmask)
+
+	dir := t.TempDir()
+	tarPath := writeTarGz(t, dir, []tarEntry{
+		{name: "bin/kafka-server-start.sh", typeflag: tar.TypeReg, body: "#!/bin/bash", mode: 0775},
+		{name: "config/server.properties", typeflag: tar.TypeReg, body: "broker.id=0", mode: 0664},
+	})
+
+	zipPath := filepath.Join(dir, "archive.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	for name, mode := range map[string]os.FileMode{"bin/kafka-server-start.sh": 0775, "config/server.properties": 0664} {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(mode)
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = writer.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = zipFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archivePath := range []string{tarPath, zipPath} {
+		extractDir := filepath.Join(dir, filepath.Base(archivePath)+"-extracted")
+		if err := Extract(context.Background(), archivePath, extractDir, ExtractLayout{}); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]os.FileMode{"bin/kafka-server-start.sh": 0775, "config/server.properties": 0664} {
+			stat, err := os.Stat(filepath.Join(extractDir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Mode().Perm() != want {
+				t.Errorf("%s of %s has mode %v, want %v", name, filepath.Base(archivePath), stat.Mode().Perm(), want)
+			}
+		}
+	}
+}